@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+var noAdjacent = flag.String("no-adjacent", "", "comma separated trait_types whose value must differ between NFTs with consecutive indexes")
+
+// sharedAdjacentTrait returns the first -no-adjacent trait_type for which
+// layers has a value in common with previous, the layers of the token just
+// before it. None never counts as shared.
+func sharedAdjacentTrait(previous, layers []Layer) string {
+	if *noAdjacent == "" || previous == nil {
+		return ""
+	}
+
+	for _, trait := range strings.Split(*noAdjacent, ",") {
+		trait = strings.TrimSpace(trait)
+		values := map[string]bool{}
+		for _, layer := range previous {
+			if layer.Trait == trait && layer.Path != "" {
+				values[normalizeName(layer.Name)] = true
+			}
+		}
+		for _, layer := range layers {
+			if layer.Trait == trait && layer.Path != "" && values[normalizeName(layer.Name)] {
+				return trait
+			}
+		}
+	}
+	return ""
+}
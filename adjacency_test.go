@@ -0,0 +1,57 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNoAdjacent(t *testing.T) {
+	tests := []struct {
+		name        string
+		traits      string
+		backgrounds []string
+		env         []string
+	}{
+		{"two backgrounds alternate", "Background", []string{"amber#8.png", "blue.png"}, nil},
+		{"weighted backgrounds", "Background", []string{"amber#8.png", "blue.png", "cyan.png"}, nil},
+		{"two constrained traits", "Background,Eyes", []string{"amber#8.png", "blue.png", "cyan.png"}, nil},
+		{"optional trait", "Eyes", []string{"amber#8.png", "blue.png", "cyan.png"}, []string{"DIR2_ABSENCE=0.4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), tt.backgrounds...)
+			writeLayers(t, filepath.Join(work, "2 Eyes"), "big#4.png", "small.png", "sleepy.png")
+			writeLayers(t, filepath.Join(work, "3 Mouth"), "a.png", "b.png", "c.png", "d.png", "e.png", "f.png")
+			env := append([]string{"DIR1=1 Background", "DIR2=2 Eyes", "DIR3=3 Mouth", "NFT_COUNT=25", "OUTPUT_DIR=out"}, tt.env...)
+			out := mustRunMixer(t, work, env, "-seed", "2", "-no-adjacent", tt.traits)
+			if strings.Contains(out, "Warning: NFT") {
+				t.Errorf("the rule gave way:\n%s", out)
+			}
+
+			var previous Metadata
+			for i := 1; i <= 25; i++ {
+				var meta Metadata
+				readJSON(t, filepath.Join(work, "out", strconv.Itoa(i)+".json"), &meta)
+				for _, trait := range strings.Split(tt.traits, ",") {
+					value, last := attributeOf(meta, trait), attributeOf(previous, trait)
+					if i > 1 && value == last && value != noneTrait {
+						t.Errorf("NFTs %d and %d share %s %s", i-1, i, trait, value)
+					}
+				}
+				previous = meta
+			}
+		})
+	}
+}
+
+func attributeOf(meta Metadata, trait string) string {
+	for _, attr := range meta.Attributes {
+		if attr.TraitType == trait {
+			return attr.Value
+		}
+	}
+	return ""
+}
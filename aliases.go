@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var aliasFile = flag.String("aliases", "", "JSON file mapping renamed layer files per trait_type, {\"BACKGROUND\": {\"old.png\": \"new.png\"}}, so older manifests still resolve")
+
+// aliases maps a trait_type to the renames of its layer files.
+var aliases map[string]map[string]string
+
+func loadAliases() error {
+	if *aliasFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(*aliasFile)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, &aliases)
+	if err != nil {
+		return fmt.Errorf("invalid -aliases file '%s': %v", *aliasFile, err)
+	}
+
+	// Chains of renames must end, resolveAlias follows them
+	for trait, renames := range aliases {
+		for name := range renames {
+			seen := map[string]bool{}
+			for current, ok := name, true; ok; current, ok = renames[current] {
+				if seen[current] {
+					return fmt.Errorf("aliases of %s '%s' form a cycle", trait, name)
+				}
+				seen[current] = true
+			}
+		}
+	}
+	return nil
+}
+
+// resolveAlias returns the current name of a layer file of trait.
+func resolveAlias(trait, name string) string {
+	for {
+		renamed, ok := aliases[trait][name]
+		if !ok {
+			return name
+		}
+		name = renamed
+	}
+}
+
+// resolveLayerAlias points a layer recorded under an old file name at the
+// renamed file in the same directory.
+func resolveLayerAlias(layer Layer) Layer {
+	name := resolveAlias(layer.Trait, layer.Name)
+	if name == layer.Name {
+		return layer
+	}
+	layer.Name = name
+	if layer.Path != "" {
+		layer.Path = filepath.Join(filepath.Dir(layer.Path), name)
+	}
+	return layer
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestAliasedManifestReproduces(t *testing.T) {
+	tests := []struct {
+		name    string
+		aliases string
+		renamed string
+		args    []string
+		// fails when the prior manifest can't be resolved
+		fails bool
+	}{
+		{"resume with an alias", `{"Hat": {"crown.png": "royal.png"}}`, "royal.png", []string{"-resume"}, false},
+		{"chained renames", `{"Hat": {"crown.png": "tiara.png", "tiara.png": "royal.png"}}`, "royal.png", []string{"-resume"}, false},
+		{"rerender with an alias", `{"Hat": {"crown.png": "royal.png"}}`, "royal.png", []string{"-rerender-affected", filepath.Join("2 Hat", "royal.png")}, false},
+		{"resume without an alias", "", "royal.png", []string{"-resume"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "red.png", "blue.png")
+			writeLayers(t, filepath.Join(work, "2 Hat"), "cap.png", "crown.png", "fez.png")
+			env := []string{"DIR1=1 Background", "DIR2=2 Hat", "NFT_COUNT=6", "OUTPUT_DIR=out"}
+			mustRunMixer(t, work, env, "-seed", "5")
+			out := filepath.Join(work, "out")
+
+			// Drop the images of the crown tokens, the ones that need the alias
+			var manifest Manifest
+			readJSON(t, filepath.Join(out, "manifest.json"), &manifest)
+			before := map[int][]byte{}
+			for _, token := range manifest.Tokens {
+				for _, layer := range token.Layers {
+					if layer.Name != "crown.png" {
+						continue
+					}
+					path := filepath.Join(out, strconv.Itoa(token.Index)+".png")
+					data, err := os.ReadFile(path)
+					if err != nil {
+						t.Fatal(err)
+					}
+					before[token.Index] = data
+					if err := os.Remove(path); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if len(before) == 0 {
+				t.Fatal("no token has the crown")
+			}
+
+			if err := os.Rename(filepath.Join(work, "2 Hat", "crown.png"), filepath.Join(work, "2 Hat", tt.renamed)); err != nil {
+				t.Fatal(err)
+			}
+			args := tt.args
+			if tt.aliases != "" {
+				writeFile(t, filepath.Join(work, "aliases.json"), tt.aliases)
+				args = append(args, "-aliases", "aliases.json")
+			}
+			output, err := runMixer(t, work, env, args...)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("the renamed file was found without an alias:\n%s", output)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%v\n%s", err, output)
+			}
+
+			for i, want := range before {
+				got, err := os.ReadFile(filepath.Join(out, strconv.Itoa(i)+".png"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("token %d isn't the composite it was before the rename", i)
+				}
+			}
+		})
+	}
+}
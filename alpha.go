@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"image"
+	"image/color"
+)
+
+var cleanAlphaMode = flag.String("clean-alpha", "", "clean layer alpha on load: 'zero' clears color under fully transparent pixels, 'unpremultiply' fixes layers saved with premultiplied alpha")
+
+// cleanLayerAlpha applies the -clean-alpha mode, checked in main, to a
+// decoded layer.
+func cleanLayerAlpha(img image.Image) image.Image {
+	switch *cleanAlphaMode {
+	case "zero":
+		return cleanAlpha(img)
+	case "unpremultiply":
+		return unpremultiplyAlpha(img)
+	}
+	return img
+}
+
+// cleanAlpha returns a copy of img whose fully transparent pixels are
+// transparent black, so no hidden color can leak in when the layer is
+// filtered or blended.
+func cleanAlpha(img image.Image) image.Image {
+	bounds := img.Bounds()
+	cleaned := image.NewNRGBA(bounds)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A == 0 {
+				continue
+			}
+			cleaned.SetNRGBA(x, y, c)
+		}
+	}
+
+	return cleaned
+}
+
+// unpremultiplyAlpha divides the color of every pixel by its alpha. PNGs
+// store straight alpha, so layers exported with premultiplied color would
+// otherwise get dark halos around their soft edges.
+func unpremultiplyAlpha(img image.Image) image.Image {
+	bounds := img.Bounds()
+	fixed := image.NewNRGBA(bounds)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A == 0 {
+				continue
+			}
+			if c.A < 255 {
+				c.R = unpremultiply(c.R, c.A)
+				c.G = unpremultiply(c.G, c.A)
+				c.B = unpremultiply(c.B, c.A)
+			}
+			fixed.SetNRGBA(x, y, c)
+		}
+	}
+
+	return fixed
+}
+
+func unpremultiply(v, a uint8) uint8 {
+	if v >= a {
+		return 255
+	}
+	return uint8((uint32(v)*255 + uint32(a)/2) / uint32(a))
+}
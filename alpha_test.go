@@ -0,0 +1,102 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCleanAlphaCompositing(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		// edge is the stored color of the layer's edge pixels, the center
+		// is opaque red
+		edge color.NRGBA
+		// want is the edge pixel composited over white
+		want color.NRGBA
+	}{
+		{"hidden color under transparency is cleared", "zero", color.NRGBA{0, 255, 0, 0}, color.NRGBA{255, 255, 255, 255}},
+		{"hidden color without cleaning", "", color.NRGBA{0, 255, 0, 0}, color.NRGBA{255, 255, 255, 255}},
+		{"premultiplied edge gets a dark fringe", "", color.NRGBA{128, 0, 0, 128}, color.NRGBA{191, 127, 127, 255}},
+		{"unpremultiplied edge has none", "unpremultiply", color.NRGBA{128, 0, 0, 128}, color.NRGBA{255, 127, 127, 255}},
+		{"unpremultiply keeps opaque pixels", "unpremultiply", color.NRGBA{10, 20, 30, 255}, color.NRGBA{10, 20, 30, 255}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, "clean-alpha", tt.mode)
+			root := t.TempDir()
+
+			// A red center on a one pixel edge
+			asset := solid(4, 4, tt.edge)
+			draw.Draw(asset, image.Rect(1, 1, 3, 3), image.NewUniform(color.NRGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+			writePNG(t, filepath.Join(root, "Hat", "cap.png"), asset)
+			writePNG(t, filepath.Join(root, "Background", "white.png"), solid(4, 4, color.White))
+
+			layers := []Layer{
+				{Name: "white.png", Trait: "Background", Path: filepath.Join(root, "Background", "white.png")},
+				{Name: "cap.png", Trait: "Hat", Path: filepath.Join(root, "Hat", "cap.png"), Jitter: &Jitter{Scale: 1.5}},
+			}
+			if err := loadLayers(layers); err != nil {
+				t.Fatal(err)
+			}
+			if tt.mode == "zero" {
+				if c := color.NRGBAModel.Convert(layers[1].Image.At(0, 0)); c != (color.NRGBA{}) {
+					t.Errorf("transparent pixel kept color %v", c)
+				}
+			}
+
+			// The jitter scales the layer, filtering the edge into its
+			// neighbors, and the unscaled one is checked too
+			scaled := combineLayers(layers)
+			layers[1].Jitter = nil
+			plain := combineLayers(layers)
+
+			if got := color.NRGBAModel.Convert(plain.At(0, 0)).(color.NRGBA); !near(got, tt.want) {
+				t.Errorf("edge composited to %v, want %v", got, tt.want)
+			}
+			for y := 0; y < 4; y++ {
+				for x := 0; x < 4; x++ {
+					if c := color.NRGBAModel.Convert(scaled.At(x, y)).(color.NRGBA); c.G > c.B+1 {
+						t.Errorf("pixel %d,%d of the scaled composite is tinted green: %v", x, y, c)
+					}
+				}
+			}
+		})
+	}
+}
+
+// near reports whether every channel of a and b is within 1.
+func near(a, b color.NRGBA) bool {
+	d := func(x, y uint8) bool { return abs(int(x)-int(y)) <= 1 }
+	return d(a.R, b.R) && d(a.G, b.G) && d(a.B, b.B) && d(a.A, b.A)
+}
+
+func TestInvalidCleanAlpha(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"generation", nil},
+		{"trait samples", []string{"-sample-traits", "Hat"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Hat"), "cap.png", "crown.png")
+			env := []string{"DIR1=1 Hat", "NFT_COUNT=1", "OUTPUT_DIR=out"}
+			out, err := runMixer(t, work, env, append([]string{"-clean-alpha", "premultiply"}, tt.args...)...)
+
+			if err == nil || !strings.Contains(out, "Invalid -clean-alpha value 'premultiply'") {
+				t.Fatalf("got %v:\n%s", err, out)
+			}
+			if _, err := os.Stat(filepath.Join(work, "out")); !os.IsNotExist(err) {
+				t.Error("the output directory was created")
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var assetBundle = flag.String("assets", "", "read layers from a .zip or .tar.gz bundle instead of the filesystem, DIR<n> paths are relative to its root")
+
+// openAssetBundle opens a zip or gzipped tar archive as an fs.FS. Tar
+// archives aren't seekable, so their files are repacked into an in-memory
+// zip once.
+func openAssetBundle(name string) (fs.FS, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		repacked, err := tarToZip(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return zip.NewReader(bytes.NewReader(repacked), int64(len(repacked)))
+	default:
+		return nil, fmt.Errorf("unsupported asset bundle '%s', expected .zip or .tar.gz", name)
+	}
+}
+
+func tarToZip(r io.Reader) ([]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: path.Clean(header.Name), Method: zip.Store})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.Copy(w, tr); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// getBundleLayerDirs uses the top-level directories of the bundle as trait
+// directories, ordered by their leading number, when no DIR<n> is set. A
+// bundle with a single root folder is descended into first.
+func getBundleLayerDirs(fsys fs.FS) ([]LayerDir, error) {
+	root := "."
+	for {
+		entries, err := fs.ReadDir(fsys, root)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) != 1 || !entries[0].IsDir() {
+			break
+		}
+		root = path.Join(root, entries[0].Name())
+	}
+
+	entries, err := fs.ReadDir(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.SliceStable(names, func(a, b int) bool {
+		return leadingNumber(names[a]) < leadingNumber(names[b])
+	})
+
+	dirs := []LayerDir{}
+	for n, name := range names {
+		dirs = append(dirs, newLayerDir(fmt.Sprintf("DIR%d", n+1), path.Join(root, name)))
+	}
+	return dirs, nil
+}
+
+// leadingNumber returns the number a directory name starts with, e.g. 2 for
+// "2 BODY", so 10 sorts after 9.
+func leadingNumber(name string) int {
+	end := 0
+	for end < len(name) && name[end] >= '0' && name[end] <= '9' {
+		end++
+	}
+	n, err := strconv.Atoi(name[:end])
+	if err != nil {
+		return -1
+	}
+	return n
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// packBundle writes the files under dir into a .zip or .tar.gz at name,
+// each entry under prefix.
+func packBundle(t *testing.T, name, dir, prefix string) {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	var add func(entry string, data []byte)
+	var finish func()
+	if filepath.Ext(name) == ".zip" {
+		zw := zip.NewWriter(&buf)
+		add = func(entry string, data []byte) {
+			w, err := zw.Create(entry)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(data)
+		}
+		finish = func() { zw.Close() }
+	} else {
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		add = func(entry string, data []byte) {
+			tw.WriteHeader(&tar.Header{Name: entry, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+			tw.Write(data)
+		}
+		finish = func() { tw.Close(); gz.Close() }
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel, _ := filepath.Rel(dir, file)
+		add(prefix+filepath.ToSlash(rel), data)
+	}
+	finish()
+	writeFile(t, name, buf.String())
+}
+
+func TestAssetBundle(t *testing.T) {
+	tests := []struct {
+		name   string
+		bundle string
+		prefix string
+		// dirEnv sets DIR<n> in the bundle, otherwise its folders are found
+		dirEnv bool
+	}{
+		{"zip with DIR paths", "assets.zip", "", true},
+		{"zip with one root folder", "assets.zip", "collection/", false},
+		{"tar.gz with DIR paths", "assets.tar.gz", "", true},
+		{"tar.gz found folders", "assets.tar.gz", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := t.TempDir()
+			writeLayers(t, filepath.Join(src, "1 Background"), "blue.png", "red.png", "teal.png")
+			writeLayers(t, filepath.Join(src, "2 Body"), "round.png", "tall#3.png")
+			writeLayers(t, filepath.Join(src, "10 Hat"), "cap.png", "crown#0.5.png")
+			work := t.TempDir()
+			packBundle(t, filepath.Join(work, tt.bundle), src, tt.prefix)
+
+			env := []string{"NFT_COUNT=8", "OUTPUT_DIR=out"}
+			mustRunMixer(t, src, append(env, "DIR1=1 Background", "DIR2=2 Body", "DIR3=10 Hat"), "-seed", "4")
+			if tt.dirEnv {
+				env = append(env, "DIR1="+tt.prefix+"1 Background", "DIR2="+tt.prefix+"2 Body", "DIR3="+tt.prefix+"10 Hat")
+			}
+			mustRunMixer(t, work, env, "-seed", "4", "-assets", tt.bundle)
+
+			for i := 1; i <= 8; i++ {
+				for _, name := range []string{strconv.Itoa(i) + ".png", strconv.Itoa(i) + ".json"} {
+					want, err := os.ReadFile(filepath.Join(src, "out", name))
+					if err != nil {
+						t.Fatal(err)
+					}
+					got, err := os.ReadFile(filepath.Join(work, "out", name))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(got, want) {
+						t.Errorf("%s from the bundle differs from the one from disk", name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestUnsupportedAssetBundle(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "assets.rar")
+	writeFile(t, name, "not an archive")
+	if _, err := openAssetBundle(name); err == nil {
+		t.Error("a .rar bundle was opened")
+	}
+}
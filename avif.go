@@ -0,0 +1,20 @@
+//go:build avif
+
+package main
+
+import (
+	"image"
+	"io"
+
+	"github.com/gen2brain/avif"
+)
+
+// Building with -tags avif adds OUTPUT_FORMAT=avif. The encoder loads the
+// shared libavif when it's installed and falls back to a bundled
+// WebAssembly build of it (always with -tags avif,nodynamic), which keeps
+// it out of default builds.
+func init() {
+	optionalEncoders["avif"] = func(w io.Writer, img image.Image, quality int) error {
+		return avif.Encode(w, img, avif.Options{Quality: quality, QualityAlpha: quality, Speed: avif.DefaultSpeed, ChromaSubsampling: image.YCbCrSubsampleRatio420})
+	}
+}
@@ -0,0 +1,83 @@
+//go:build avif
+
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+
+	"github.com/gen2brain/avif"
+)
+
+func TestEncodeAVIF(t *testing.T) {
+	// Flat quadrants, which survive lossy compression close to their color
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	quadrants := []color.NRGBA{{200, 40, 40, 255}, {40, 200, 40, 255}, {40, 40, 200, 255}, {230, 230, 230, 128}}
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			img.SetNRGBA(x, y, quadrants[x/16+2*(y/16)])
+		}
+	}
+
+	tests := []struct {
+		name      string
+		quality   int
+		tolerance int
+	}{
+		{"low quality", 40, 40},
+		{"default quality", 90, 16},
+		{"lossless", 100, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := encodeImage(&buf, img, "avif", WithQuality(tt.quality)); err != nil {
+				t.Fatal(err)
+			}
+			// An ISO BMFF file starting with an ftyp box of the avif brand
+			data := buf.Bytes()
+			if len(data) < 12 || string(data[4:8]) != "ftyp" || string(data[8:12]) != "avif" {
+				t.Fatalf("no avif ftyp box: % x", data[:min(len(data), 16)])
+			}
+
+			decoded, err := avif.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Bounds() != img.Bounds() {
+				t.Fatalf("decoded %v, want %v", decoded.Bounds(), img.Bounds())
+			}
+			for q, want := range quadrants {
+				x, y := 8+16*(q%2), 8+16*(q/2)
+				got := color.NRGBAModel.Convert(decoded.At(x, y)).(color.NRGBA)
+				for _, d := range []int{int(got.R) - int(want.R), int(got.G) - int(want.G), int(got.B) - int(want.B), int(got.A) - int(want.A)} {
+					if abs(d) > tt.tolerance {
+						t.Errorf("pixel %d,%d is %v, want %v", x, y, got, want)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAVIFOutput(t *testing.T) {
+	work := t.TempDir()
+	writeLayers(t, filepath.Join(work, "1 Background"), "a.png", "b.png")
+	env := []string{"DIR1=1 Background", "NFT_COUNT=2", "OUTPUT_DIR=out", "OUTPUT_FORMAT=avif", "OUTPUT_QUALITY=80"}
+	mustRunMixer(t, work, env, "-seed", "1")
+	for _, name := range []string{"1.avif", "2.avif"} {
+		var meta Metadata
+		readJSON(t, filepath.Join(work, "out", name[:1]+".json"), &meta)
+		if meta.Image != name {
+			t.Errorf("metadata points at %s, want %s", meta.Image, name)
+		}
+		data := mustReadTree(t, filepath.Join(work, "out"))[name]
+		if _, err := avif.Decode(bytes.NewReader(data)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+var baseImage = flag.String("base", "", "generate variations of a single image instead of layering traits")
+var variations = flag.Int("variations", 10, "number of variations to generate with -base")
+
+// baseTrait is the trait_type recorded for transforms of the -base image.
+const baseTrait = "Base"
+
+// generateVariations writes count variations of the base image, each with
+// its own color shift and jitter drawn from the BASE_ ranges.
+func generateVariations(base string, count int, outputDir string) error {
+	hsv := getHSVRanges("BASE")
+	jitter := getJitterRanges("BASE")
+	if !hsv.enabled() && !jitter.enabled() {
+		return fmt.Errorf("-base needs BASE_HUE, BASE_SATURATION, BASE_VALUE, BASE_JITTER_SCALE or BASE_JITTER_OFFSET to vary the image")
+	}
+
+	createOutputDir(outputDir)
+
+	for i := 1; i < count+1; i++ {
+		rng := tokenRand(i)
+
+		layer := Layer{Name: base, Trait: baseTrait, Path: base}
+		if hsv.enabled() {
+			layer.Shift = hsv.drawShift(rng, baseTrait)
+		}
+		if jitter.enabled() {
+			layer.Jitter = jitter.drawJitter(rng)
+		}
+
+		layers := []Layer{layer}
+		err := loadLayers(layers)
+		if err != nil {
+			return err
+		}
+
+		meta := Metadata{
+			Name:       fmt.Sprintf("#%d", i),
+			Attributes: []Attribute{},
+			Jitter:     layer.Jitter,
+		}
+		if layer.Shift != nil {
+			meta.ColorShifts = []ColorShift{*layer.Shift}
+		}
+
+		meta.Image = saveImageToFile(i, applyMask(combineLayers(layers)), outputDir)
+		saveMetadataToFile(i, meta, outputDir)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestGenerateVariations(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{"hue", map[string]string{"BASE_HUE": "-90:90"}},
+		{"saturation and value", map[string]string{"BASE_SATURATION": "-0.5:0", "BASE_VALUE": "-0.5:0"}},
+		{"jitter", map[string]string{"BASE_JITTER_OFFSET": "3", "BASE_JITTER_SCALE": "0.2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			// A red square on a transparent border, so moves show
+			base := image.NewNRGBA(image.Rect(0, 0, 12, 12))
+			for y := 3; y < 9; y++ {
+				for x := 3; x < 9; x++ {
+					base.SetNRGBA(x, y, color.NRGBA{220, 40, 40, 255})
+				}
+			}
+			writePNG(t, filepath.Join(root, "base.png"), base)
+
+			// generate returns the image and metadata files of the variations
+			generate := func(seed, dir string) (images, metas [][]byte) {
+				setFlag(t, "seed", seed)
+				out := filepath.Join(root, dir)
+				if err := generateVariations(filepath.Join(root, "base.png"), 4, out); err != nil {
+					t.Fatal(err)
+				}
+				read := func(name string) []byte {
+					data, err := os.ReadFile(filepath.Join(out, name))
+					if err != nil {
+						t.Fatal(err)
+					}
+					return data
+				}
+				for i := 1; i <= 4; i++ {
+					images = append(images, read(strconv.Itoa(i)+".png"))
+					metas = append(metas, read(strconv.Itoa(i)+".json"))
+				}
+				return images, metas
+			}
+
+			images, metas := generate("8", "first")
+			againImages, againMetas := generate("8", "again")
+			_, otherMetas := generate("9", "other")
+			for n := range images {
+				if !bytes.Equal(images[n], againImages[n]) || !bytes.Equal(metas[n], againMetas[n]) {
+					t.Errorf("variation %d changed with the same seed", n+1)
+				}
+				// Close shifts can round to the same pixels, so compare
+				// the recorded transforms
+				if bytes.Equal(metas[n], otherMetas[n]) {
+					t.Errorf("variation %d is the same with another seed", n+1)
+				}
+				for m := range images[:n] {
+					if bytes.Equal(images[n], images[m]) {
+						t.Errorf("variations %d and %d are identical", m+1, n+1)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateVariationsNeedsRanges(t *testing.T) {
+	root := t.TempDir()
+	writePNG(t, filepath.Join(root, "base.png"), solid(2, 2, color.White))
+	if err := generateVariations(filepath.Join(root, "base.png"), 2, filepath.Join(root, "out")); err == nil {
+		t.Fatal("variations generated without any BASE_ range")
+	}
+}
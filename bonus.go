@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+)
+
+var bonusLayer = flag.String("bonus-layer", "", "special layer composited on top of lucky NFTs, outside the normal trait pool")
+var bonusChance = flag.Float64("bonus-chance", 0.01, "probability that an NFT is lucky and gets -bonus-layer")
+var bonusTrait = flag.String("bonus-trait", "Bonus", "trait_type recorded for -bonus-layer")
+
+// bonusSalt salts the draw deciding which indexes are lucky.
+const bonusSalt = 0x626f6e75
+
+func isLucky(i int) bool {
+	rng := saltedRandomizer(bonusSalt, i)
+	return rng.Float64() < *bonusChance
+}
+
+// addBonusLayer appends the bonus layer to the layers of token i if it is
+// lucky.
+func addBonusLayer(i int, layers []Layer) []Layer {
+	if *bonusLayer == "" || !isLucky(i) {
+		return layers
+	}
+	return append(layers, Layer{Name: filepath.Base(*bonusLayer), Trait: *bonusTrait, Path: *bonusLayer})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestLuckyIndexes(t *testing.T) {
+	tests := []struct {
+		name   string
+		seed   string
+		chance string
+	}{
+		{"rare", "3", "0.2"},
+		{"common", "3", "0.7"},
+		{"other seed", "4", "0.2"},
+	}
+	lucky := map[string][]int{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "red.png", "blue.png", "green.png", "gray.png")
+			writeLayers(t, filepath.Join(work, "2 Hat"), "cap.png", "crown.png", "beanie.png", "fez.png")
+
+			// An opaque corner mark that no trait file has
+			star := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+			star.SetNRGBA(0, 0, color.NRGBA{255, 0, 255, 255})
+			writePNG(t, filepath.Join(work, "star.png"), star)
+
+			env := []string{"DIR1=1 Background", "DIR2=2 Hat", "NFT_COUNT=12", "OUTPUT_DIR=out"}
+			args := []string{"-seed", tt.seed, "-bonus-layer", "star.png", "-bonus-chance", tt.chance, "-bonus-trait", "Star"}
+			mustRunMixer(t, work, env, args...)
+
+			// The bonus doesn't depend on the layer draws, only the seed
+			setFlag(t, "seed", tt.seed)
+			setFlag(t, "bonus-chance", tt.chance)
+
+			var got []int
+			for i := 1; i <= 12; i++ {
+				var meta Metadata
+				readJSON(t, filepath.Join(work, "out", strconv.Itoa(i)+".json"), &meta)
+				hasBonus := false
+				for _, attr := range meta.Attributes {
+					if attr.TraitType == "Star" && attr.Value == "star" {
+						hasBonus = true
+					}
+				}
+				marked := color.NRGBAModel.Convert(readPNG(t, filepath.Join(work, "out", strconv.Itoa(i)+".png")).At(0, 0)) == color.NRGBA{255, 0, 255, 255}
+
+				if hasBonus != isLucky(i) || marked != isLucky(i) {
+					t.Errorf("token %d: lucky %v, bonus attribute %v, bonus drawn %v", i, isLucky(i), hasBonus, marked)
+				}
+				if hasBonus {
+					got = append(got, i)
+				}
+			}
+			if len(got) == 0 || len(got) == 12 {
+				t.Errorf("lucky tokens %v at chance %s", got, tt.chance)
+			}
+			lucky[tt.name] = got
+		})
+	}
+
+	// A higher chance only adds lucky tokens, another seed picks others
+	for _, i := range lucky["rare"] {
+		if !slices.Contains(lucky["common"], i) {
+			t.Errorf("token %d is lucky at 0.2 but not 0.7", i)
+		}
+	}
+	if reflect.DeepEqual(lucky["rare"], lucky["other seed"]) {
+		t.Errorf("seeds 3 and 4 have the same lucky tokens %v", lucky["rare"])
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Range is an inclusive interval values are drawn from uniformly.
+type Range struct {
+	Min, Max float64
+}
+
+func (r Range) draw(rng Randomizer) float64 {
+	if r.Min == r.Max {
+		return r.Min
+	}
+	return r.Min + rng.Float64()*(r.Max-r.Min)
+}
+
+// String returns the range in its MIN:MAX form, quoted for YAML.
+func (r Range) String() string {
+	return strconv.Quote(strconv.FormatFloat(r.Min, 'g', -1, 64) + ":" + strconv.FormatFloat(r.Max, 'g', -1, 64))
+}
+
+// getRange parses an environment variable of the form MIN:MAX. A single
+// number N is read as -N:N.
+func getRange(key string) Range {
+	value := os.Getenv(key)
+	if value == "" {
+		return Range{}
+	}
+
+	bounds := strings.SplitN(value, ":", 2)
+	if len(bounds) == 1 {
+		bounds = []string{"-" + strings.TrimPrefix(bounds[0], "-"), bounds[0]}
+	}
+	min, err1 := strconv.ParseFloat(strings.TrimSpace(bounds[0]), 64)
+	max, err2 := strconv.ParseFloat(strings.TrimSpace(bounds[1]), 64)
+	if err1 != nil || err2 != nil || min > max {
+		log.Fatalf("Invalid %s range '%s', expected MIN:MAX", key, value)
+	}
+	return Range{min, max}
+}
+
+// HSVRanges configures per-token color variation. Hue is in degrees,
+// saturation and value are offsets on a 0..1 scale.
+type HSVRanges struct {
+	Hue, Saturation, Value Range
+}
+
+// getHSVRanges reads <prefix>_HUE, <prefix>_SATURATION and <prefix>_VALUE.
+func getHSVRanges(prefix string) HSVRanges {
+	return HSVRanges{
+		Hue:        getRange(prefix + "_HUE"),
+		Saturation: getRange(prefix + "_SATURATION"),
+		Value:      getRange(prefix + "_VALUE"),
+	}
+}
+
+func (r HSVRanges) enabled() bool {
+	return r != HSVRanges{}
+}
+
+// ColorShift is the HSV shift applied to a trait, recorded in metadata.
+type ColorShift struct {
+	TraitType  string  `json:"trait_type"`
+	Hue        float64 `json:"hue"`
+	Saturation float64 `json:"saturation"`
+	Value      float64 `json:"value"`
+}
+
+// drawShift picks a shift within the ranges. Values are rounded so the
+// metadata describes exactly what was applied.
+func (r HSVRanges) drawShift(rng Randomizer, trait string) *ColorShift {
+	round := func(v float64) float64 {
+		return math.Round(v*1000) / 1000
+	}
+	return &ColorShift{
+		TraitType:  trait,
+		Hue:        round(r.Hue.draw(rng)),
+		Saturation: round(r.Saturation.draw(rng)),
+		Value:      round(r.Value.draw(rng)),
+	}
+}
+
+// shiftHSV rotates the hue of every pixel by h degrees and offsets its
+// saturation and value by s and v, clamped to 0..1. Alpha is kept.
+func shiftHSV(img image.Image, h, s, v float64) image.Image {
+	bounds := img.Bounds()
+	shifted := image.NewNRGBA(bounds)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A == 0 {
+				continue
+			}
+
+			hue, sat, val := rgbToHSV(c.R, c.G, c.B)
+			hue = math.Mod(hue+h, 360)
+			if hue < 0 {
+				hue += 360
+			}
+			sat = clamp01(sat + s)
+			val = clamp01(val + v)
+
+			r, g, b := hsvToRGB(hue, sat, val)
+			shifted.SetNRGBA(x, y, color.NRGBA{r, g, b, c.A})
+		}
+	}
+
+	return shifted
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// rgbToHSV returns hue in degrees and saturation and value in 0..1.
+func rgbToHSV(r, g, b uint8) (float64, float64, float64) {
+	rf, gf, bf := float64(r)/255, float64(g)/255, float64(b)/255
+	max := math.Max(rf, math.Max(gf, bf))
+	min := math.Min(rf, math.Min(gf, bf))
+	delta := max - min
+
+	var h float64
+	switch {
+	case delta == 0:
+		h = 0
+	case max == rf:
+		h = 60 * math.Mod((gf-bf)/delta, 6)
+	case max == gf:
+		h = 60 * ((bf-rf)/delta + 2)
+	default:
+		h = 60 * ((rf-gf)/delta + 4)
+	}
+	if h < 0 {
+		h += 360
+	}
+
+	var s float64
+	if max > 0 {
+		s = delta / max
+	}
+	return h, s, max
+}
+
+func hsvToRGB(h, s, v float64) (uint8, uint8, uint8) {
+	c := v * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := v - c
+
+	var rf, gf, bf float64
+	switch {
+	case h < 60:
+		rf, gf, bf = c, x, 0
+	case h < 120:
+		rf, gf, bf = x, c, 0
+	case h < 180:
+		rf, gf, bf = 0, c, x
+	case h < 240:
+		rf, gf, bf = 0, x, c
+	case h < 300:
+		rf, gf, bf = x, 0, c
+	default:
+		rf, gf, bf = c, 0, x
+	}
+
+	to8 := func(f float64) uint8 {
+		return uint8(math.Round((f + m) * 255))
+	}
+	return to8(rf), to8(gf), to8(bf)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+func TestDrawShiftSeeded(t *testing.T) {
+	ranges := HSVRanges{Hue: Range{-30, 30}, Saturation: Range{-0.2, 0.2}, Value: Range{-0.1, 0}}
+	tests := []struct {
+		name string
+		seed int64
+		i    int
+	}{
+		{"first token", 1, 1},
+		{"other token", 1, 2},
+		{"other seed", 99, 1},
+	}
+	shifts := map[ColorShift]bool{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := ranges.drawShift(newRandomizer(deriveSeed(tt.seed, tt.i)), "Skin")
+			b := ranges.drawShift(newRandomizer(deriveSeed(tt.seed, tt.i)), "Skin")
+			if *a != *b {
+				t.Fatalf("same seed drew %+v and %+v", *a, *b)
+			}
+			if a.Hue < -30 || a.Hue > 30 || a.Saturation < -0.2 || a.Saturation > 0.2 || a.Value < -0.1 || a.Value > 0 {
+				t.Errorf("%+v is outside the ranges %+v", *a, ranges)
+			}
+			shifts[*a] = true
+		})
+	}
+	if len(shifts) != len(tests) {
+		t.Errorf("different seeds or tokens drew the same shift: %v", shifts)
+	}
+}
+
+func TestShiftHSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      color.NRGBA
+		h, s, v float64
+		want    color.NRGBA
+	}{
+		{"red to green", color.NRGBA{255, 0, 0, 255}, 120, 0, 0, color.NRGBA{0, 255, 0, 255}},
+		{"red to blue", color.NRGBA{255, 0, 0, 255}, 240, 0, 0, color.NRGBA{0, 0, 255, 255}},
+		{"negative hue wraps", color.NRGBA{255, 0, 0, 255}, -60, 0, 0, color.NRGBA{255, 0, 255, 255}},
+		{"full turn", color.NRGBA{200, 100, 50, 255}, 360, 0, 0, color.NRGBA{200, 100, 50, 255}},
+		{"desaturated", color.NRGBA{255, 0, 0, 255}, 0, -1, 0, color.NRGBA{255, 255, 255, 255}},
+		{"darkened", color.NRGBA{255, 0, 0, 255}, 0, 0, -0.5, color.NRGBA{128, 0, 0, 255}},
+		{"clamped", color.NRGBA{255, 0, 0, 255}, 0, 0, 2, color.NRGBA{255, 0, 0, 255}},
+		{"alpha kept", color.NRGBA{255, 0, 0, 100}, 120, 0, 0, color.NRGBA{0, 255, 0, 100}},
+		{"transparent left alone", color.NRGBA{255, 0, 0, 0}, 120, 0, 0, color.NRGBA{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := color.NRGBAModel.Convert(shiftHSV(solid(1, 1, tt.in), tt.h, tt.s, tt.v).At(0, 0))
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShiftMovesHue(t *testing.T) {
+	tests := []struct {
+		in color.NRGBA
+		h  float64
+	}{
+		{color.NRGBA{200, 100, 50, 255}, 30},
+		{color.NRGBA{40, 160, 90, 255}, -45},
+		{color.NRGBA{90, 60, 220, 255}, 170},
+	}
+	for _, tt := range tests {
+		before, _, _ := rgbToHSV(tt.in.R, tt.in.G, tt.in.B)
+		c := color.NRGBAModel.Convert(shiftHSV(solid(1, 1, tt.in), tt.h, 0, 0).At(0, 0)).(color.NRGBA)
+		after, _, _ := rgbToHSV(c.R, c.G, c.B)
+
+		moved := math.Mod(after-before+360, 360)
+		want := math.Mod(tt.h+360, 360)
+		if math.Abs(moved-want) > 1 {
+			t.Errorf("%v shifted by %g moved hue by %.2f", tt.in, tt.h, moved)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+var companionManifest = flag.String("companion-manifest", "", "manifest.json of a companion collection, token N copies the -sticky traits of its token N")
+var sticky = flag.String("sticky", "", "comma separated trait_types taken from -companion-manifest instead of drawn")
+
+// companion holds the layers of each token of the companion collection.
+var companion map[int][]Layer
+
+// loadCompanion reads -companion-manifest, checking that every -sticky
+// trait_type belongs to one of dirs.
+func loadCompanion(dirs []LayerDir) error {
+	if *companionManifest == "" {
+		if *sticky != "" {
+			return fmt.Errorf("-sticky needs a -companion-manifest")
+		}
+		return nil
+	}
+	if *sticky == "" {
+		return fmt.Errorf("-companion-manifest needs the -sticky trait_types to copy")
+	}
+
+	for trait := range getStickyTraits() {
+		found := false
+		for _, dir := range dirs {
+			found = found || getTraitType(dir) == trait
+		}
+		if !found {
+			return fmt.Errorf("no layer directory has sticky trait_type '%s'", trait)
+		}
+	}
+
+	manifest, err := readManifestFile(*companionManifest)
+	if err != nil {
+		return err
+	}
+	companion = map[int][]Layer{}
+	for _, token := range manifest.Tokens {
+		companion[token.Index] = token.Layers
+	}
+	return nil
+}
+
+func getStickyTraits() map[string]bool {
+	traits := map[string]bool{}
+	for _, trait := range strings.Split(*sticky, ",") {
+		if trait = strings.TrimSpace(trait); trait != "" {
+			traits[trait] = true
+		}
+	}
+	return traits
+}
+
+// applySticky replaces the layers of every sticky trait_type with the file
+// of the same value in its own directory that companion token i uses,
+// keeping the companion's color shift and jitter. Other layers are kept.
+func applySticky(i int, layers []Layer, dirs []LayerDir) ([]Layer, error) {
+	if companion == nil {
+		return layers, nil
+	}
+	companionLayers, ok := companion[i]
+	if !ok {
+		return nil, fmt.Errorf("companion manifest has no token %d", i)
+	}
+
+	traits := getStickyTraits()
+	var result []Layer
+	for _, dir := range dirs {
+		trait := getTraitType(dir)
+		if !traits[trait] {
+			for _, layer := range layers {
+				if layer.Trait == trait {
+					result = append(result, layer)
+				}
+			}
+			continue
+		}
+
+		assets, err := listAssets([]LayerDir{dir})
+		if err != nil {
+			return nil, err
+		}
+		for _, layer := range companionLayers {
+			if layer.Trait != trait {
+				continue
+			}
+			if layer.Path == "" {
+				result = append(result, Layer{Name: noneTrait, Trait: trait})
+				continue
+			}
+
+			match := ""
+			for _, asset := range assets {
+				if normalizeName(filepath.Base(asset)) == normalizeName(layer.Name) {
+					match = asset
+				}
+			}
+			if match == "" {
+				return nil, fmt.Errorf("companion token %d has %s '%s', which '%s' doesn't have", i, trait, normalizeName(layer.Name), dir.Path)
+			}
+			layer.Name = filepath.Base(match)
+			layer.Path = match
+			layer.Gray = dir.Gray
+			layer.Preprocess = dir.Preprocess
+			result = append(result, layer)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestCompanionStickyTraits(t *testing.T) {
+	tests := []struct {
+		name string
+		// ownerEnv is added to the owner collection's environment
+		ownerEnv []string
+		// petBackgrounds are the file names of the pets' Background
+		petBackgrounds []string
+	}{
+		{"same file names", nil, []string{"blue.png", "green.png", "red.png"}},
+		{"weights differ between collections", nil, []string{"blue#5.png", "green#0.1.png", "red.png"}},
+		{"absent companion trait", []string{"DIR1_ABSENCE=0.5"}, []string{"blue.png", "green.png", "red.png"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owners := t.TempDir()
+			writeLayers(t, filepath.Join(owners, "1 Background"), "blue.png", "green.png", "red.png")
+			writeLayers(t, filepath.Join(owners, "2 Body"), "tall.png", "short.png", "round.png", "thin.png")
+			env := append([]string{"DIR1=1 Background", "DIR2=2 Body", "NFT_COUNT=8", "OUTPUT_DIR=out"}, tt.ownerEnv...)
+			mustRunMixer(t, owners, env, "-seed", "3")
+
+			pets := t.TempDir()
+			writeLayers(t, filepath.Join(pets, "1 Background"), tt.petBackgrounds...)
+			writeLayers(t, filepath.Join(pets, "2 Pet"), "cat.png", "dog.png", "fox.png", "owl.png", "yak.png")
+			env = []string{"DIR1=1 Background", "DIR2=2 Pet", "NFT_COUNT=8", "OUTPUT_DIR=out"}
+			mustRunMixer(t, pets, env, "-seed", "11", "-companion-manifest", filepath.Join(owners, "out", "manifest.json"), "-sticky", "Background")
+
+			petValues := map[string]bool{}
+			for i := 1; i <= 8; i++ {
+				var owner, pet Metadata
+				readJSON(t, filepath.Join(owners, "out", strconv.Itoa(i)+".json"), &owner)
+				readJSON(t, filepath.Join(pets, "out", strconv.Itoa(i)+".json"), &pet)
+				if pet.Attributes[0].Value != owner.Attributes[0].Value {
+					t.Errorf("pet %d has Background %s, its owner %s", i, pet.Attributes[0].Value, owner.Attributes[0].Value)
+				}
+				petValues[pet.Attributes[1].Value] = true
+			}
+			if len(petValues) < 3 {
+				t.Errorf("pets only drew %v", petValues)
+			}
+		})
+	}
+}
+
+func TestCompanionNeedsSticky(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"sticky without manifest", []string{"-sticky", "Background"}},
+		{"manifest without sticky", []string{"-companion-manifest", "manifest.json"}},
+		{"unknown sticky trait", []string{"-companion-manifest", "manifest.json", "-sticky", "Hat"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "blue.png")
+			writeFile(t, filepath.Join(work, "manifest.json"), `{"tokens": []}`)
+			out, err := runMixer(t, work, []string{"DIR1=1 Background", "NFT_COUNT=1", "OUTPUT_DIR=out"}, tt.args...)
+			if err == nil {
+				t.Fatalf("%v succeeded:\n%s", tt.args, out)
+			}
+		})
+	}
+}
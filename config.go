@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+
+	"github.com/joho/godotenv"
+)
+
+var dumpConfig = flag.Bool("dump-config", false, "print the resolved flags, environment and directory settings as YAML and exit without generating")
+
+// envSource tells where the value of an environment variable came from.
+// godotenv never overrides variables that are already set, so a value that
+// differs from the .env file was set in the environment.
+func envSource(key string, file map[string]string) string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return "default"
+	}
+	if fileValue, inFile := file[key]; inFile && fileValue == value {
+		return ".env"
+	}
+	return "environment"
+}
+
+// writeConfig writes the configuration the run would use, after .env
+// loading and defaults, as YAML. Each value is commented with its source.
+func writeConfig(w io.Writer, dirs []LayerDir, outputDir string) {
+	file, _ := godotenv.Read()
+
+	fmt.Fprintln(w, "flags:")
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	flag.VisitAll(func(f *flag.Flag) {
+		source := "default"
+		switch {
+		case set[f.Name]:
+			source = "flag"
+		case f.Name == "seed":
+			source = seedSource
+		}
+		fmt.Fprintf(w, "  %s: %s # %s\n", f.Name, strconv.Quote(f.Value.String()), source)
+	})
+
+	fmt.Fprintln(w, "env:")
+	env := []struct{ key, value string }{
+		{"NFT_COUNT", os.Getenv("NFT_COUNT")},
+		{"OUTPUT_DIR", outputDir},
+		{"IMAGE_WORKERS", strconv.Itoa(getWorkerCount("IMAGE_WORKERS", runtime.NumCPU()))},
+		{"META_WORKERS", strconv.Itoa(getWorkerCount("META_WORKERS", 2))},
+		{"TARGET_RESOLUTION", os.Getenv("TARGET_RESOLUTION")},
+		{"OUTPUT_FORMAT", getOutputFormat()},
+		{"OUTPUT_QUALITY", strconv.Itoa(getOutputQuality())},
+		{"NAME", defaultEnv("NAME", "#{index}")},
+		{"DESCRIPTION", os.Getenv("DESCRIPTION")},
+		{"LOCALES", os.Getenv("LOCALES")},
+	}
+	if *baseImage != "" {
+		for _, key := range []string{"BASE_HUE", "BASE_SATURATION", "BASE_VALUE", "BASE_JITTER_SCALE", "BASE_JITTER_OFFSET"} {
+			env = append(env, struct{ key, value string }{key, os.Getenv(key)})
+		}
+	}
+	for _, e := range env {
+		fmt.Fprintf(w, "  %s: %s # %s\n", e.key, strconv.Quote(e.value), envSource(e.key, file))
+	}
+	for _, locale := range getLocales() {
+		for _, field := range []string{"NAME", "DESCRIPTION"} {
+			key := localeEnv(field, locale)
+			fmt.Fprintf(w, "  %s: %s # %s\n", key, strconv.Quote(os.Getenv(key)), envSource(key, file))
+		}
+	}
+
+	fmt.Fprintln(w, "dirs:")
+	for _, dir := range dirs {
+		fmt.Fprintf(w, "  - key: %s\n", dir.Key)
+		fmt.Fprintf(w, "    path: %s\n", strconv.Quote(dir.Path))
+		fmt.Fprintf(w, "    trait_type: %s\n", strconv.Quote(getTraitType(dir)))
+		fmt.Fprintf(w, "    pick: %d\n", dir.Pick)
+		fmt.Fprintf(w, "    absence: %g\n", dir.Absence)
+		fmt.Fprintf(w, "    grouped: %t\n", dir.Grouped)
+		if dir.HSV.enabled() {
+			fmt.Fprintf(w, "    hue: %s\n", dir.HSV.Hue)
+			fmt.Fprintf(w, "    saturation: %s\n", dir.HSV.Saturation)
+			fmt.Fprintf(w, "    value: %s\n", dir.HSV.Value)
+		}
+		if dir.Jitter.enabled() {
+			fmt.Fprintf(w, "    jitter_scale: %s\n", dir.Jitter.Scale)
+			fmt.Fprintf(w, "    jitter_offset: %s\n", dir.Jitter.Offset)
+		}
+		if dir.Gray.Mode != "" {
+			fmt.Fprintf(w, "    gray: %s\n", dir.Gray.Mode)
+			fmt.Fprintf(w, "    tint: \"%02x%02x%02x\"\n", dir.Gray.Tint.R, dir.Gray.Tint.G, dir.Gray.Tint.B)
+		}
+		if len(dir.Preprocess) > 0 {
+			fmt.Fprintf(w, "    preprocess: %s\n", strconv.Quote(dir.Preprocess.String()))
+		}
+		if len(dir.Values) > 0 {
+			fmt.Fprintf(w, "    values: %s\n", strconv.Quote(os.Getenv(dir.Key+"_VALUES")))
+		}
+	}
+}
+
+// defaultEnv returns the value of key, or def when it isn't set.
+func defaultEnv(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDumpConfigSources(t *testing.T) {
+	work := t.TempDir()
+	writeLayers(t, filepath.Join(work, "1 Background"), "a.png")
+	writeFile(t, filepath.Join(work, ".env"), "DIR1=1 Background\nNFT_COUNT=3\nNAME=File {index}\nOUTPUT_FORMAT=jpeg\nOUTPUT_DIR=from-file\n")
+	env := []string{"NAME=Env {index}", "OUTPUT_DIR=from-env", "OUTPUT_QUALITY=70"}
+	out := mustRunMixer(t, work, env, "-dump-config", "-seed", "5", "-thumbnails", "32")
+
+	tests := []struct {
+		key, value, source string
+	}{
+		// Flags given on the command line win over their defaults
+		{"seed", "5", "flag"},
+		{"thumbnails", "32", "flag"},
+		{"chunk-size", "0", "default"},
+		// The environment wins over the .env file
+		{"NAME", "Env {index}", "environment"},
+		{"OUTPUT_DIR", "from-env", "environment"},
+		{"OUTPUT_QUALITY", "70", "environment"},
+		// The .env file wins over defaults
+		{"NFT_COUNT", "3", ".env"},
+		{"OUTPUT_FORMAT", "jpeg", ".env"},
+		{"DESCRIPTION", "", "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			want := "  " + tt.key + ": " + strconv.Quote(tt.value) + " # " + tt.source + "\n"
+			if !strings.Contains(out, want) {
+				t.Errorf("no line %q in:\n%s", want, out)
+			}
+		})
+	}
+	if strings.Contains(out, "Seed:") {
+		t.Error("-dump-config started a generation")
+	}
+	if _, err := os.Stat(filepath.Join(work, "from-env")); !os.IsNotExist(err) {
+		t.Error("-dump-config created the output directory")
+	}
+}
+
+func TestDumpConfigDerived(t *testing.T) {
+	tests := []struct {
+		name string
+		env  []string
+		args []string
+		want string
+	}{
+		{"seed from the time", nil, nil, `(?m)^  seed: "\d+" # time$`},
+		{"base ranges", []string{"BASE_HUE=30"}, []string{"-base", "base.png"}, `(?m)^  BASE_HUE: "30" # environment$`},
+		{"unset base range", []string{"BASE_HUE=30"}, []string{"-base", "base.png"}, `(?m)^  BASE_VALUE: "" # default$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "a.png")
+			writeLayers(t, work, "base.png")
+			env := append([]string{"DIR1=1 Background", "NFT_COUNT=1", "OUTPUT_DIR=out"}, tt.env...)
+			out := mustRunMixer(t, work, env, append([]string{"-dump-config"}, tt.args...)...)
+
+			if !regexp.MustCompile(tt.want).MatchString(out) {
+				t.Errorf("no line matching %s in:\n%s", tt.want, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+var requireAllTraitTypes = flag.Bool("require-all-trait-types", false, "fail at the end of the run if some trait_type is absent from every token")
+var traitCoverage = flag.Bool("trait-coverage", false, "report layer files that were never selected once generation finishes")
+
+// listAssets returns the path of every layer file of the directories.
+func listAssets(dirs []LayerDir) ([]string, error) {
+	var assets []string
+	for _, dir := range dirs {
+		groups, err := getLayerGroups(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range groups {
+			files, err := listLayerFiles(group)
+			if err != nil {
+				return nil, err
+			}
+			for _, file := range files {
+				assets = append(assets, filepath.Join(group.Path, file.Name()))
+			}
+		}
+	}
+	return assets, nil
+}
+
+// reportTraitCoverage prints the assets with zero appearances in usage,
+// which usually points at a weight or configuration mistake.
+func reportTraitCoverage(dirs []LayerDir, usage map[string]int) error {
+	assets, err := listAssets(dirs)
+	if err != nil {
+		return err
+	}
+
+	var unused []string
+	for _, asset := range assets {
+		if usage[asset] == 0 {
+			unused = append(unused, asset)
+		}
+	}
+
+	fmt.Printf("Trait coverage: %d of %d assets used\n", len(assets)-len(unused), len(assets))
+	for _, asset := range unused {
+		fmt.Println("  never used:", asset)
+	}
+	return nil
+}
+
+// checkAllTraitTypes returns an error naming every trait_type of dirs that
+// is None or missing in all tokens.
+func checkAllTraitTypes(dirs []LayerDir, tokens *tokenStore) error {
+	tokens.mu.Lock()
+	counts := traitCounts(tokens.metas)
+	tokens.mu.Unlock()
+
+	var missing []string
+	for _, dir := range dirs {
+		trait := getTraitType(dir)
+
+		present := 0
+		for value, n := range counts[trait] {
+			if value != noneTrait {
+				present += n
+			}
+		}
+		if present == 0 {
+			missing = append(missing, trait)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("trait_type %s never appears in the collection", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTraitCoverage(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  []string
+		used   string
+		unused []string
+	}{
+		{"every asset used", []string{"a.png", "b.png"}, "Trait coverage: 4 of 4 assets used", nil},
+		{"weight zero asset", []string{"a.png", "b#0.png"}, "Trait coverage: 3 of 4 assets used", []string{"b#0.png"}},
+		{"two disabled assets", []string{"a.png", "b#0.png", "c#0.png"}, "Trait coverage: 3 of 5 assets used", []string{"b#0.png", "c#0.png"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "red.png", "blue.png")
+			writeLayers(t, filepath.Join(work, "2 Hat"), tt.files...)
+			env := []string{"DIR1=1 Background", "DIR2=2 Hat", "NFT_COUNT=2", "OUTPUT_DIR=out"}
+			out := mustRunMixer(t, work, env, "-seed", "1", "-trait-coverage")
+
+			if !strings.Contains(out, tt.used) {
+				t.Errorf("output doesn't say %q:\n%s", tt.used, out)
+			}
+			if got := strings.Count(out, "never used:"); got != len(tt.unused) {
+				t.Errorf("%d assets reported, want %d:\n%s", got, len(tt.unused), out)
+			}
+			for _, file := range tt.unused {
+				if !strings.Contains(out, "never used: "+filepath.Join("2 Hat", file)) {
+					t.Errorf("%s isn't reported:\n%s", file, out)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckAllTraitTypes(t *testing.T) {
+	dirs := []LayerDir{{Key: "DIR1", Path: "1 Background"}, {Key: "DIR2", Path: "2 Hat"}, {Key: "DIR3", Path: "3 Glasses"}}
+	token := func(hat, glasses string) Metadata {
+		return Metadata{Attributes: []Attribute{{"Background", "red", nil}, {"Hat", hat, nil}, {"Glasses", glasses, nil}}}
+	}
+	tests := []struct {
+		name    string
+		metas   []Metadata
+		missing string
+	}{
+		{"every trait_type appears", []Metadata{token("cap", noneTrait), token(noneTrait, "round")}, ""},
+		{"one always None", []Metadata{token(noneTrait, "round"), token(noneTrait, "square")}, "Hat"},
+		{"two always None", []Metadata{token(noneTrait, noneTrait), token(noneTrait, noneTrait)}, "Hat, Glasses"},
+		{"missing from the attributes", []Metadata{{Attributes: []Attribute{{"Background", "red", nil}, {"Hat", "cap", nil}}}}, "Glasses"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := newTokenStore()
+			for i, meta := range tt.metas {
+				tokens.add(i+1, meta, nil)
+			}
+			err := checkAllTraitTypes(dirs, tokens)
+			if tt.missing == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "trait_type "+tt.missing+" never appears") {
+				t.Fatalf("got %v, want %s reported", err, tt.missing)
+			}
+		})
+	}
+}
+
+func TestRequireAllTraitTypesRun(t *testing.T) {
+	work := t.TempDir()
+	writeLayers(t, filepath.Join(work, "1 Background"), "red.png", "blue.png", "green.png")
+	writeLayers(t, filepath.Join(work, "2 Hat"), "cap.png")
+	env := []string{"DIR1=1 Background", "DIR2=2 Hat", "DIR2_ABSENCE=0.99999", "NFT_COUNT=3", "OUTPUT_DIR=out"}
+	out, err := runMixer(t, work, env, "-seed", "1", "-require-all-trait-types")
+	if err == nil || !strings.Contains(out, "trait_type Hat never appears in the collection") {
+		t.Fatalf("got %v:\n%s", err, out)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sizeSalt salts the sample token of the size estimate.
+const sizeSalt = 0x73697a65
+
+// estimateOutputSize renders one sample NFT and extrapolates the bytes of
+// its image, metadata, thumbnail and manifest entry to nftCount tokens.
+// Compression makes real images vary around the sample, so it's an
+// estimate only. The sample's re-rolls aren't counted with the run's.
+func estimateOutputSize(dirs []LayerDir, nftCount int) (int64, error) {
+	layers, err := selectToken(1, saltedRandomizer(sizeSalt, 1), dirs, nil)
+	if err != nil {
+		return 0, err
+	}
+	err = loadLayers(layers)
+	if err != nil {
+		return 0, err
+	}
+	img := renderToken(1, layers)
+
+	var buf bytes.Buffer
+	err = encodeImage(&buf, img, getOutputFormat(), getOutputOptions()...)
+	if err != nil {
+		return 0, err
+	}
+	perToken := int64(buf.Len())
+
+	meta, err := encodeMetadata(buildMetadata(1, layers))
+	if err != nil {
+		return 0, err
+	}
+	perToken += int64(len(meta))
+
+	// Tier folders hold a copy of every image and metadata file
+	if *splitTiers {
+		perToken *= 2
+	}
+
+	// Every token also gets an entry in manifest.json
+	entry, err := encodeJSON(ManifestToken{Index: 1, Image: "1" + getFormatExtension(getOutputFormat()), Checksum: strings.Repeat("0", 64), Layers: layers})
+	if err != nil {
+		return 0, err
+	}
+	perToken += int64(len(entry))
+	if *thumbnails > 0 {
+		buf.Reset()
+		err = encodeImage(&buf, makeThumbnail(img, *thumbnails), getOutputFormat(), getOutputOptions()...)
+		if err != nil {
+			return 0, err
+		}
+		perToken += int64(buf.Len())
+	}
+	return perToken * int64(nftCount), nil
+}
+
+// getMaxTotalBytes reads MAX_TOTAL_MB, or returns 0 when it isn't set.
+func getMaxTotalBytes() int64 {
+	value := os.Getenv("MAX_TOTAL_MB")
+	if value == "" {
+		return 0
+	}
+	mb, err := strconv.ParseFloat(value, 64)
+	if err != nil || mb <= 0 {
+		log.Fatalf("Invalid MAX_TOTAL_MB value '%s'", value)
+	}
+	return int64(mb * 1e6)
+}
+
+// checkDiskUsage prints the estimated size of the collection and fails
+// before anything is written if it's above MAX_TOTAL_MB or the free space
+// of the disk outputDir is on. A resumed run only counts the tokens it adds.
+func checkDiskUsage(dirs []LayerDir, nftCount int, outputDir string) error {
+	tokens := nftCount
+	if *resume {
+		manifest, err := readManifest(outputDir)
+		if err != nil {
+			return err
+		}
+		for _, token := range manifest.Tokens {
+			if token.Index <= nftCount {
+				tokens--
+			}
+		}
+	}
+
+	estimate, err := estimateOutputSize(dirs, tokens)
+	if err != nil {
+		return err
+	}
+	if *resume {
+		fmt.Printf("Estimated output size of the %d tokens to add: %s\n", tokens, formatSize(estimate))
+	} else {
+		fmt.Printf("Estimated output size: %s\n", formatSize(estimate))
+	}
+
+	if limit := getMaxTotalBytes(); limit > 0 && estimate > limit {
+		return fmt.Errorf("the run would write about %s, more than MAX_TOTAL_MB=%s", formatSize(estimate), os.Getenv("MAX_TOTAL_MB"))
+	}
+
+	// The output directory doesn't exist yet, ask for its closest parent
+	dir := outputDir
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	if free, ok := freeDiskSpace(dir); ok && estimate > free {
+		return fmt.Errorf("the run would write about %s but only %s are free on the disk of '%s'", formatSize(estimate), formatSize(free), outputDir)
+	}
+	return nil
+}
+
+func formatSize(bytes int64) string {
+	switch {
+	case bytes >= 1e9:
+		return fmt.Sprintf("%.1f GB", float64(bytes)/1e9)
+	case bytes >= 1e6:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/1e6)
+	}
+	return fmt.Sprintf("%.1f KB", float64(bytes)/1e3)
+}
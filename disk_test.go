@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// estimatedKB reads the estimated size the command printed, in KB.
+func estimatedKB(t *testing.T, out string) float64 {
+	t.Helper()
+	match := regexp.MustCompile(`Estimated output size.*: ([\d.]+) KB`).FindStringSubmatch(out)
+	if match == nil {
+		t.Fatalf("no size estimate in the output:\n%s", out)
+	}
+	kb, _ := strconv.ParseFloat(match[1], 64)
+	return kb
+}
+
+func TestOutputSizeEstimate(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"images and metadata", nil},
+		{"tier copies", []string{"-split-tiers", "50"}},
+		{"thumbnails", []string{"-thumbnails", "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "dawn.png", "dusk.png", "noon.png", "night.png")
+			writeLayers(t, filepath.Join(work, "2 Bird"), "crow.png", "gull.png", "wren.png", "kite.png")
+			env := []string{"DIR1=1 Background", "DIR2=2 Bird", "NFT_COUNT=6", "OUTPUT_DIR=out"}
+			out := mustRunMixer(t, work, env, append([]string{"-seed", "5"}, tt.args...)...)
+
+			// Only the token files, their copies and the manifest are
+			// estimated
+			written := 0
+			for name, data := range mustReadTree(t, filepath.Join(work, "out")) {
+				if name == "manifest.json" || regexp.MustCompile(`(^|/)\d+\.(png|json)$`).MatchString(name) {
+					written += len(data)
+				}
+			}
+			estimate := estimatedKB(t, out) * 1e3
+			if ratio := estimate / float64(written); ratio < 0.85 || ratio > 1.15 {
+				t.Errorf("estimated %.0f bytes, the run wrote %d", estimate, written)
+			}
+		})
+	}
+}
+
+func TestEstimateCountsNoRerolls(t *testing.T) {
+	work := t.TempDir()
+	var dirs []LayerDir
+	for d, trait := range []string{"Hat", "Glasses", "Pet"} {
+		key := fmt.Sprintf("DIR%d", d+1)
+		writeLayers(t, filepath.Join(work, trait), "a.png", "b.png")
+		// Nearly every draw has fewer than 3 traits and is re-rolled
+		t.Setenv(key+"_ABSENCE", "0.6")
+		dirs = append(dirs, newLayerDir(key, filepath.Join(work, trait)))
+	}
+	setFlag(t, "min-traits", "3")
+	old := rerolls
+	rerolls = &rerollCounts{counts: map[string]int{}}
+	t.Cleanup(func() { rerolls = old })
+
+	if _, err := estimateOutputSize(dirs, 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(rerolls.counts) > 0 {
+		t.Errorf("the estimate added re-rolls %v", rerolls.counts)
+	}
+}
+
+func TestMaxTotalMB(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxMB   string
+		resumed bool
+		// err is empty when the run goes ahead
+		err string
+	}{
+		{"under the cap", "1", false, ""},
+		{"over the cap", "0.002", false, "more than MAX_TOTAL_MB=0.002"},
+		{"invalid", "lots", false, "Invalid MAX_TOTAL_MB value 'lots'"},
+		{"resume adds few tokens", "0.002", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "dawn.png", "dusk.png", "noon.png", "night.png")
+			writeLayers(t, filepath.Join(work, "2 Bird"), "crow.png", "gull.png", "wren.png", "kite.png")
+			env := []string{"DIR1=1 Background", "DIR2=2 Bird", "OUTPUT_DIR=out"}
+			var args []string
+			if tt.resumed {
+				mustRunMixer(t, work, append(env, "NFT_COUNT=7"), "-seed", "5")
+				args = []string{"-resume"}
+			}
+
+			out, err := runMixer(t, work, append(env, "NFT_COUNT=8", "MAX_TOTAL_MB="+tt.maxMB), args...)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("%v\n%s", err, out)
+				}
+				if tt.resumed && !strings.Contains(out, "Estimated output size of the 1 tokens to add") {
+					t.Errorf("resume doesn't estimate only the missing token:\n%s", out)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("run succeeded:\n%s", out)
+			}
+			if !strings.Contains(out, tt.err) {
+				t.Errorf("output doesn't say %q:\n%s", tt.err, out)
+			}
+			// Aborted before writing any of the collection
+			if _, err := os.Stat(filepath.Join(work, "out")); !os.IsNotExist(err) {
+				t.Error("the output directory was created")
+			}
+		})
+	}
+}
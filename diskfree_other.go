@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd
+
+package main
+
+// freeDiskSpace can't tell the free space on this platform, only
+// MAX_TOTAL_MB is checked.
+func freeDiskSpace(path string) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,16 @@
+//go:build embed
+
+package main
+
+import "embed"
+
+// Building with -tags embed bakes the my_layers folder into the binary, so
+// it can generate without the layer directories next to it. DIR<n> paths
+// stay the same, e.g. DIR1=./my_layers/1 BACKGROUND.
+//
+//go:embed my_layers
+var embeddedLayers embed.FS
+
+func init() {
+	layerSource = fsSource{embeddedLayers}
+}
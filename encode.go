@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// encodeBuffers are reused across image workers so every image is encoded
+// into memory and written with a single os.WriteFile.
+var encodeBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// pngBuffers lets the png encoder reuse its zlib writer and row buffers.
+type pngBuffers struct{ pool sync.Pool }
+
+func (p *pngBuffers) Get() *png.EncoderBuffer {
+	buf, _ := p.pool.Get().(*png.EncoderBuffer)
+	return buf
+}
+
+func (p *pngBuffers) Put(buf *png.EncoderBuffer) {
+	p.pool.Put(buf)
+}
+
+var pngEncoder = png.Encoder{BufferPool: &pngBuffers{}}
+
+// optionalEncoders are formats whose encoders are only compiled in with a
+// build tag, see avif.go.
+var optionalEncoders = map[string]func(w io.Writer, img image.Image, quality int) error{}
+
+// supportedFormat reports whether encodeImage can write format.
+func supportedFormat(format string) bool {
+	_, ok := optionalEncoders[format]
+	return ok || format == "png" || format == "jpeg"
+}
+
+type encodeOptions struct {
+	quality   int
+	interlace bool
+	optimize  bool
+}
+
+// EncodeOption changes how encodeImage encodes an image.
+type EncodeOption func(*encodeOptions)
+
+// WithQuality sets the quality (1-100) of lossy formats.
+func WithQuality(quality int) EncodeOption {
+	return func(o *encodeOptions) {
+		o.quality = quality
+	}
+}
+
+// WithInterlace writes Adam7 interlaced PNGs.
+func WithInterlace(interlace bool) EncodeOption {
+	return func(o *encodeOptions) {
+		o.interlace = interlace
+	}
+}
+
+// WithOptimize shrinks PNGs losslessly, see optimizeForCompression and
+// reduceColorType.
+func WithOptimize(optimize bool) EncodeOption {
+	return func(o *encodeOptions) {
+		o.optimize = optimize
+	}
+}
+
+// encodeImage encodes img to w in the given format ("png", "jpeg" or one
+// of optionalEncoders), independent of where the bytes end up.
+func encodeImage(w io.Writer, img image.Image, format string, opts ...EncodeOption) error {
+	o := encodeOptions{quality: 90}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	switch format {
+	case "png":
+		if o.optimize {
+			optimized := optimizedCopy(img)
+			img = optimized
+			// The interlaced writer only writes RGBA
+			if !o.interlace {
+				img = reduceColorType(optimized)
+			}
+		}
+		if o.interlace {
+			return encodeInterlacedPNG(w, img)
+		}
+		return pngEncoder.Encode(w, img)
+	case "jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: o.quality})
+	default:
+		if encode, ok := optionalEncoders[format]; ok {
+			return encode(w, img, o.quality)
+		}
+		return fmt.Errorf("unsupported image format '%s'", format)
+	}
+}
+
+// getOutputFormat reads OUTPUT_FORMAT, png by default.
+func getOutputFormat() string {
+	format := os.Getenv("OUTPUT_FORMAT")
+	switch format {
+	case "":
+		return "png"
+	case "jpg":
+		return "jpeg"
+	}
+	return format
+}
+
+// getFormatExtension returns the file extension of an output format.
+func getFormatExtension(format string) string {
+	if format == "jpeg" {
+		return ".jpg"
+	}
+	return "." + format
+}
+
+// getOutputOptions returns the encoding options of the configured output.
+func getOutputOptions() []EncodeOption {
+	return []EncodeOption{WithInterlace(*interlace), WithQuality(getOutputQuality()), WithOptimize(*optimize)}
+}
+
+// getOutputQuality reads OUTPUT_QUALITY, 90 by default.
+func getOutputQuality() int {
+	value := os.Getenv("OUTPUT_QUALITY")
+	if value == "" {
+		return 90
+	}
+	quality, err := strconv.Atoi(value)
+	if err != nil || quality < 1 || quality > 100 {
+		log.Fatalf("Invalid OUTPUT_QUALITY value '%s'", value)
+	}
+	return quality
+}
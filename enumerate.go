@@ -0,0 +1,283 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+var enumerateAbove = flag.Float64("enumerate-above", 0.5, "when NFT_COUNT exceeds this fraction of all combinations, enumerate them and sample without replacement instead of re-rolling duplicates (0 disables)")
+
+// maxEnumerated bounds the combinations held in memory for enumeration.
+const maxEnumerated = 1 << 20
+
+// layerOption is one outcome of a directory: the files it contributes, or
+// none when the layer is absent, and its probability.
+type layerOption struct {
+	files  []string
+	weight float64
+}
+
+// getLayerOptions lists every outcome of dir. A group of Pick files is
+// weighted by the product of their weights, which matches the draw without
+// replacement for single picks and approximates it for larger ones.
+func getLayerOptions(dir LayerDir) ([]layerOption, error) {
+	var options []layerOption
+	if dir.Absence > 0 {
+		options = append(options, layerOption{weight: dir.Absence})
+	}
+
+	groups, err := getLayerGroups(dir)
+	if err != nil {
+		return nil, err
+	}
+	groupNames := make([]string, len(groups))
+	for g, group := range groups {
+		groupNames[g] = filepath.Base(group.Path)
+	}
+	groupWeights := []float64{1}
+	if dir.Grouped {
+		groupWeights = normalizeWeights(getFileWeights(groupNames))
+	}
+
+	for g, group := range groups {
+		files, err := listLayerFiles(group)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		var weights []float64
+		for f, weight := range getFileWeights(fileNames(files)) {
+			if weight > 0 {
+				names = append(names, filepath.Join(group.Path, files[f].Name()))
+				weights = append(weights, weight)
+			}
+		}
+
+		var subsets []layerOption
+		total := 0.0
+		forEachSubset(len(names), dir.Pick, func(picked []int) bool {
+			option := layerOption{weight: 1}
+			for _, f := range picked {
+				option.files = append(option.files, names[f])
+				option.weight *= weights[f]
+			}
+			total += option.weight
+			subsets = append(subsets, option)
+			return len(subsets) <= maxEnumerated
+		})
+		if len(subsets) > maxEnumerated {
+			return nil, fmt.Errorf("%s has too many combinations to enumerate", dir.Key)
+		}
+
+		for _, option := range subsets {
+			option.weight = option.weight / total * groupWeights[g] * (1 - dir.Absence)
+			options = append(options, option)
+		}
+	}
+	return options, nil
+}
+
+func fileNames(files []fs.DirEntry) []string {
+	names := make([]string, len(files))
+	for f, file := range files {
+		names[f] = file.Name()
+	}
+	return names
+}
+
+func normalizeWeights(weights []float64) []float64 {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	normalized := make([]float64, len(weights))
+	for i, w := range weights {
+		if total > 0 {
+			normalized[i] = w / total
+		}
+	}
+	return normalized
+}
+
+// forEachSubset calls fn with every k-subset of 0..n-1 in lexicographic
+// order until fn returns false.
+func forEachSubset(n, k int, fn func(picked []int) bool) {
+	if k > n {
+		return
+	}
+	picked := make([]int, k)
+	for i := range picked {
+		picked[i] = i
+	}
+	for {
+		if !fn(picked) {
+			return
+		}
+		i := k - 1
+		for i >= 0 && picked[i] == n-k+i {
+			i--
+		}
+		if i < 0 {
+			return
+		}
+		picked[i]++
+		for j := i + 1; j < k; j++ {
+			picked[j] = picked[j-1] + 1
+		}
+	}
+}
+
+// combinationSampler draws unique combinations by weight without
+// replacement from the fully enumerated combination space. Near saturation
+// this takes one draw per NFT where rejection sampling keeps re-rolling.
+type combinationSampler struct {
+	dirs    []LayerDir
+	options [][]layerOption
+	// weights is a Fenwick tree over point, the weight of each combination
+	// still available. A combination's index is the mixed radix number of
+	// its option indexes.
+	weights []float64
+	point   []float64
+	size    int
+	left    int
+}
+
+// newCombinationSampler enumerates the combinations of dirs when nftCount
+// is more than -enumerate-above of them. It returns nil when rejection
+// sampling should be used instead.
+func newCombinationSampler(dirs []LayerDir, nftCount int) (*combinationSampler, error) {
+	if *enumerateAbove <= 0 || *companionManifest != "" || *noAdjacent != "" || *resume || *useQuotas {
+		return nil, nil
+	}
+
+	s := &combinationSampler{dirs: dirs, size: 1}
+	for _, dir := range dirs {
+		options, err := getLayerOptions(dir)
+		if err != nil {
+			return nil, err
+		}
+		s.options = append(s.options, options)
+		s.size *= len(options)
+		if s.size > maxEnumerated {
+			return nil, nil
+		}
+	}
+	if float64(nftCount) <= *enumerateAbove*float64(s.size) {
+		return nil, nil
+	}
+
+	s.weights = make([]float64, s.size+1)
+	s.point = make([]float64, s.size)
+	digits := make([]int, len(dirs))
+	for c := 0; c < s.size; c++ {
+		s.decode(c, digits)
+		weight, present := 1.0, 0
+		for d, o := range digits {
+			weight *= s.options[d][o].weight
+			present += len(s.options[d][o].files)
+		}
+		if present == 0 || present < *minTraits || weight <= 0 {
+			continue
+		}
+		s.point[c] = weight
+		s.add(c, weight)
+		s.left++
+	}
+
+	if nftCount > s.left {
+		return nil, fmt.Errorf("NFT_COUNT is %d but the layers only allow %d unique combinations", nftCount, s.left)
+	}
+	fmt.Printf("Sampling %d of %d enumerated combinations without replacement\n", nftCount, s.left)
+	return s, nil
+}
+
+func (s *combinationSampler) decode(c int, digits []int) {
+	for d := len(s.options) - 1; d >= 0; d-- {
+		digits[d] = c % len(s.options[d])
+		c /= len(s.options[d])
+	}
+}
+
+func (s *combinationSampler) add(c int, delta float64) {
+	for i := c + 1; i <= s.size; i += i & -i {
+		s.weights[i] += delta
+	}
+}
+
+func (s *combinationSampler) total() float64 {
+	total := 0.0
+	for i := s.size; i > 0; i -= i & -i {
+		total += s.weights[i]
+	}
+	return total
+}
+
+// find returns the combination whose cumulative weight range holds r.
+func (s *combinationSampler) find(r float64) int {
+	pos := 0
+	step := 1
+	for step*2 <= s.size {
+		step *= 2
+	}
+	for ; step > 0; step /= 2 {
+		if next := pos + step; next <= s.size && s.weights[next] <= r {
+			pos = next
+			r -= s.weights[next]
+		}
+	}
+	return pos
+}
+
+// draw removes a random remaining combination and returns its layers, with
+// color shifts and jitter drawn from rng as in selectRandomLayers.
+func (s *combinationSampler) draw(rng Randomizer) []Layer {
+	c := s.find(rng.Float64() * s.total())
+	if c >= s.size {
+		c = s.size - 1
+	}
+
+	// Rounding can land on a drawn or filtered out combination, take the
+	// nearest one still available
+	for offset := 0; ; offset++ {
+		if c+offset < s.size && s.point[c+offset] > 0 {
+			c += offset
+			break
+		}
+		if c-offset >= 0 && s.point[c-offset] > 0 {
+			c -= offset
+			break
+		}
+	}
+	s.add(c, -s.point[c])
+	s.point[c] = 0
+	s.left--
+
+	digits := make([]int, len(s.dirs))
+	s.decode(c, digits)
+
+	var layers []Layer
+	for d, dir := range s.dirs {
+		trait := getTraitType(dir)
+		option := s.options[d][digits[d]]
+		if len(option.files) == 0 {
+			layers = append(layers, Layer{Name: noneTrait, Trait: trait})
+			continue
+		}
+
+		var shift *ColorShift
+		if dir.HSV.enabled() {
+			shift = dir.HSV.drawShift(rng, trait)
+		}
+		for _, path := range option.files {
+			layer := newLayer(trait, dir, path)
+			layer.Shift = shift
+			if dir.Jitter.enabled() {
+				layer.Jitter = dir.Jitter.drawJitter(rng)
+			}
+			layers = append(layers, layer)
+		}
+	}
+	return layers
+}
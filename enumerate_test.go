@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEnumerateNearSaturation(t *testing.T) {
+	// 4 backgrounds, 5 hats and 5 eyes make 100 combinations
+	tests := []struct {
+		name     string
+		nftCount int
+	}{
+		{"every combination", 100},
+		{"just above -enumerate-above", 51},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "red.png", "blue.png", "green.png", "grey.png")
+			writeLayers(t, filepath.Join(work, "2 Hat"), "cap.png", "crown.png", "fez.png", "beret.png", "helmet.png")
+			writeLayers(t, filepath.Join(work, "3 Eyes"), "calm.png", "angry.png", "sleepy.png", "wide.png", "wink.png")
+			env := []string{"DIR1=1 Background", "DIR2=2 Hat", "DIR3=3 Eyes", fmt.Sprintf("NFT_COUNT=%d", tt.nftCount), "OUTPUT_DIR=out"}
+
+			start := time.Now()
+			out := mustRunMixer(t, work, env, "-seed", "3")
+			if elapsed := time.Since(start); elapsed > 30*time.Second {
+				t.Errorf("took %v", elapsed)
+			}
+			if want := fmt.Sprintf("Sampling %d of 100 enumerated combinations", tt.nftCount); !strings.Contains(out, want) {
+				t.Errorf("output lacks %q:\n%s", want, out)
+			}
+
+			var manifest Manifest
+			readJSON(t, filepath.Join(work, "out", "manifest.json"), &manifest)
+			if len(manifest.Tokens) != tt.nftCount {
+				t.Fatalf("manifest lists %d tokens, want %d", len(manifest.Tokens), tt.nftCount)
+			}
+			seen := map[string]int{}
+			for _, token := range manifest.Tokens {
+				readPNG(t, filepath.Join(work, "out", strconv.Itoa(token.Index)+".png"))
+				key := getCacheKey(token.Layers)
+				if other, ok := seen[key]; ok {
+					t.Errorf("tokens %d and %d are both %s", other, token.Index, key)
+				}
+				seen[key] = token.Index
+			}
+		})
+	}
+}
+
+func TestSamplerLayerOptionsError(t *testing.T) {
+	tests := []struct {
+		name string
+		dir  func(root string) LayerDir
+	}{
+		{"missing directory", func(root string) LayerDir {
+			return LayerDir{Key: "DIR2", Path: filepath.Join(root, "Hat"), Pick: 1}
+		}},
+		{"grouped without subdirectories", func(root string) LayerDir {
+			writeLayers(t, filepath.Join(root, "Hat"), "cap.png")
+			return LayerDir{Key: "DIR2", Path: filepath.Join(root, "Hat"), Pick: 1, Grouped: true}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeLayers(t, filepath.Join(root, "Background"), "a.png", "b.png")
+			dirs := []LayerDir{{Key: "DIR1", Path: filepath.Join(root, "Background"), Pick: 1}, tt.dir(root)}
+			setFlag(t, "enumerate-above", "0.5")
+
+			sampler, err := newCombinationSampler(dirs, 2)
+			if err == nil {
+				t.Fatalf("got sampler %v and no error", sampler)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+var estimateUnique = flag.Int("estimate-unique", 0, "estimate from N random draws how many unique NFTs the configuration can realistically produce, without generating")
+
+// estimateSalt salts the trial draws of -estimate-unique.
+const estimateSalt = 0x65737469
+
+// printUniqueEstimate draws trials random combinations and reports how the
+// number of distinct ones grows. Skewed absence probabilities make some
+// combinations far more likely than others, so the realistic count is
+// usually well below the combinatorial maximum.
+func printUniqueEstimate(trials int, dirs []LayerDir, nftCount int) error {
+	rng := saltedRandomizer(estimateSalt, 0)
+
+	seen := map[string]int{}
+	window := trials / 20
+	if window < 10 {
+		window = 10
+	}
+	dupsInWindow := make([]bool, 0, trials)
+	saturatedAt := -1
+
+	for t := 0; t < trials; t++ {
+		layers, err := selectToken(t+1, rng, dirs, rerolls)
+		if err != nil {
+			return err
+		}
+		key := getCacheKey(layers)
+		seen[key]++
+		dupsInWindow = append(dupsInWindow, seen[key] > 1)
+
+		// Duplicates dominate once most recent draws would be re-rolled
+		if saturatedAt < 0 && len(dupsInWindow) >= window {
+			dups := 0
+			for _, dup := range dupsInWindow[len(dupsInWindow)-window:] {
+				if dup {
+					dups++
+				}
+			}
+			if dups*2 > window {
+				saturatedAt = len(seen)
+			}
+		}
+	}
+
+	// Chao1 estimate of how many combinations can be drawn at all
+	var singletons, doubletons float64
+	for _, n := range seen {
+		switch n {
+		case 1:
+			singletons++
+		case 2:
+			doubletons++
+		}
+	}
+	reachable := float64(len(seen))
+	if doubletons > 0 {
+		reachable += singletons * singletons / (2 * doubletons)
+	} else {
+		reachable += singletons * (singletons - 1) / 2
+	}
+
+	fmt.Printf("Drew %d combinations, %d distinct\n", trials, len(seen))
+	fmt.Printf("Estimated reachable combinations: %.0f\n", reachable)
+	if saturatedAt >= 0 {
+		fmt.Printf("Duplicate re-rolls dominate after about %d unique NFTs\n", saturatedAt)
+	} else {
+		fmt.Printf("Duplicate re-rolls never dominated, more than %d unique NFTs are realistic\n", len(seen))
+	}
+
+	if saturatedAt >= 0 && nftCount > saturatedAt {
+		fmt.Printf("Warning: NFT_COUNT=%d is past that point, generation will spend most draws re-rolling\n", nftCount)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEstimateUnique(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []string
+		// reachable bounds the reported reachable combinations
+		reachableMin, reachableMax float64
+		// saturatedMax bounds when duplicates dominate, 0 if they must not
+		saturatedMax int
+	}{
+		{"uniform", []string{"", "", "", ""}, 14, 20, 16},
+		{"skewed", []string{"#1000", "", "", "", "", "", "", "", "", ""}, 10, 100, 10},
+		{"mildly skewed", []string{"#4", "#2", "", "", ""}, 20, 30, 25},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			var files []string
+			for n, weight := range tt.weights {
+				files = append(files, fmt.Sprintf("file%d%s.png", n, weight))
+			}
+			writeLayers(t, filepath.Join(work, "1 Background"), files...)
+			writeLayers(t, filepath.Join(work, "2 Hat"), files...)
+			env := []string{"DIR1=1 Background", "DIR2=2 Hat", "NFT_COUNT=50", "OUTPUT_DIR=out"}
+			out := mustRunMixer(t, work, env, "-seed", "2", "-estimate-unique", "5000")
+
+			combinations := float64(len(files) * len(files))
+			reachable := parseFloat(t, out, `Estimated reachable combinations: (\d+)`)
+			distinct := parseFloat(t, out, `Drew 5000 combinations, (\d+) distinct`)
+			if distinct > combinations || reachable < distinct {
+				t.Errorf("%v distinct and %v reachable of %v combinations", distinct, reachable, combinations)
+			}
+			if reachable < tt.reachableMin || reachable > tt.reachableMax {
+				t.Errorf("estimated %v reachable, want %v to %v:\n%s", reachable, tt.reachableMin, tt.reachableMax, out)
+			}
+
+			saturated := int(parseFloat(t, out, `dominate after about (\d+) unique`))
+			if saturated > tt.saturatedMax {
+				t.Errorf("duplicates dominate after %d, want at most %d:\n%s", saturated, tt.saturatedMax, out)
+			}
+			if !strings.Contains(out, "Warning: NFT_COUNT=50 is past that point") {
+				t.Errorf("NFT_COUNT=50 past %d isn't warned about:\n%s", saturated, out)
+			}
+		})
+	}
+}
+
+func parseFloat(t *testing.T, out, pattern string) float64 {
+	t.Helper()
+	match := regexp.MustCompile(pattern).FindStringSubmatch(out)
+	if match == nil {
+		t.Fatalf("output doesn't match %s:\n%s", pattern, out)
+	}
+	v, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+var export = flag.String("export", "", "also write the whole collection in another format: 'graphql-json' writes collection.json")
+
+type ExportToken struct {
+	Index      int         `json:"index"`
+	Name       string      `json:"name"`
+	Image      string      `json:"image"`
+	Attributes []Attribute `json:"attributes"`
+}
+
+type ExportValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type ExportTraitType struct {
+	Name   string        `json:"name"`
+	Values []ExportValue `json:"values"`
+}
+
+// Collection is the nested, GraphQL friendly export of a whole collection.
+type Collection struct {
+	Tokens     []ExportToken     `json:"tokens"`
+	TraitTypes []ExportTraitType `json:"traitTypes"`
+}
+
+func saveExport(format string, tokens *tokenStore, outputDir string) error {
+	if format != "graphql-json" {
+		return fmt.Errorf("unsupported -export format '%s'", format)
+	}
+
+	collection := Collection{Tokens: []ExportToken{}, TraitTypes: []ExportTraitType{}}
+
+	// Trait types in the order they first appear, values by name
+	var traitOrder []string
+	counts := map[string]map[string]int{}
+	for _, i := range tokens.indexes() {
+		meta := tokens.metas[i]
+		collection.Tokens = append(collection.Tokens, ExportToken{Index: i, Name: meta.Name, Image: meta.Image, Attributes: meta.Attributes})
+
+		for _, attr := range meta.Attributes {
+			if counts[attr.TraitType] == nil {
+				counts[attr.TraitType] = map[string]int{}
+				traitOrder = append(traitOrder, attr.TraitType)
+			}
+			counts[attr.TraitType][attr.Value]++
+		}
+	}
+
+	for _, trait := range traitOrder {
+		traitType := ExportTraitType{Name: trait, Values: []ExportValue{}}
+		for value, count := range counts[trait] {
+			traitType.Values = append(traitType.Values, ExportValue{Value: value, Count: count})
+		}
+		sort.Slice(traitType.Values, func(a, b int) bool {
+			return traitType.Values[a].Value < traitType.Values[b].Value
+		})
+		collection.TraitTypes = append(collection.TraitTypes, traitType)
+	}
+
+	data, err := encodeJSON(collection)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outputDir, "collection.json"), data, 0644)
+}
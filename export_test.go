@@ -0,0 +1,79 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestGraphQLExport(t *testing.T) {
+	attrs := func(values ...string) []Attribute {
+		traits := []string{"Background", "Hat"}
+		var list []Attribute
+		for n, value := range values {
+			list = append(list, Attribute{TraitType: traits[n], Value: value})
+		}
+		return list
+	}
+	tests := []struct {
+		name   string
+		tokens map[int][]Attribute
+		want   []ExportTraitType
+	}{
+		{"single token", map[int][]Attribute{1: attrs("red", "cap")}, []ExportTraitType{
+			{"Background", []ExportValue{{"red", 1}}},
+			{"Hat", []ExportValue{{"cap", 1}}},
+		}},
+		{"counts per value", map[int][]Attribute{1: attrs("red", "cap"), 2: attrs("blue", "cap"), 3: attrs("red", noneTrait), 4: attrs("red", "crown")}, []ExportTraitType{
+			{"Background", []ExportValue{{"blue", 1}, {"red", 3}}},
+			{"Hat", []ExportValue{{noneTrait, 1}, {"cap", 2}, {"crown", 1}}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := newTokenStore()
+			for i, list := range tt.tokens {
+				tokens.add(i, Metadata{Name: "#" + strconv.Itoa(i), Image: strconv.Itoa(i) + ".png", Attributes: list}, nil)
+			}
+			out := t.TempDir()
+			if err := saveExport("graphql-json", tokens, out); err != nil {
+				t.Fatal(err)
+			}
+
+			// The nesting as a GraphQL client sees it
+			var raw map[string][]map[string]any
+			readJSON(t, filepath.Join(out, "collection.json"), &raw)
+			if len(raw) != 2 || raw["tokens"] == nil || raw["traitTypes"] == nil {
+				t.Fatalf("top level is %v", raw)
+			}
+			for _, token := range raw["tokens"] {
+				for _, key := range []string{"index", "name", "image", "attributes"} {
+					if _, ok := token[key]; !ok {
+						t.Errorf("token %v has no %s", token, key)
+					}
+				}
+			}
+
+			var collection Collection
+			readJSON(t, filepath.Join(out, "collection.json"), &collection)
+			if !reflect.DeepEqual(collection.TraitTypes, tt.want) {
+				t.Errorf("trait types %+v, want %+v", collection.TraitTypes, tt.want)
+			}
+			if len(collection.Tokens) != len(tt.tokens) {
+				t.Fatalf("%d tokens exported, want %d", len(collection.Tokens), len(tt.tokens))
+			}
+			for n, token := range collection.Tokens {
+				if token.Index != n+1 || !reflect.DeepEqual(token.Attributes, tt.tokens[token.Index]) {
+					t.Errorf("token %d exported as %+v", n+1, token)
+				}
+			}
+		})
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	if err := saveExport("csv", newTokenStore(), t.TempDir()); err == nil {
+		t.Fatal("unknown format exported")
+	}
+}
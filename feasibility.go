@@ -0,0 +1,175 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// feasibilityWarnAt is the number of draws per NFT, for the last NFTs of the
+// run, above which re-rolling duplicates gets noticeably slow.
+const feasibilityWarnAt = maxRerolls / 10
+
+// checkFeasibility makes sure nftCount unique combinations can be reached by
+// re-rolling duplicates. The combinatorial maximum counts a combination with
+// four absent layers like any other, but with high absence probabilities a
+// few combinations take most of the draws and the rest are rarely reached.
+//
+// Re-rolling takes the likeliest combinations first, so once nftCount-1 are
+// taken at best the probability mass of the others is left. It fails when
+// there aren't nftCount combinations at all and warns when the last NFTs are
+// expected to need more than feasibilityWarnAt draws each.
+func checkFeasibility(dirs []LayerDir, nftCount int) error {
+	options := make([][]layerOption, len(dirs))
+	for d, dir := range dirs {
+		all, err := getLayerOptions(dir)
+		if err != nil {
+			// Too many to list, the directory alone has plenty
+			return nil
+		}
+		for _, option := range all {
+			if option.weight > 0 {
+				options[d] = append(options[d], option)
+			}
+		}
+		sort.SliceStable(options[d], func(a, b int) bool {
+			return options[d][a].weight > options[d][b].weight
+		})
+		if len(options[d]) == 0 {
+			return nil
+		}
+	}
+
+	least := max(*minTraits, 1)
+	total := validMass(options, least)
+	if total <= 0 {
+		return fmt.Errorf("no combination of the layers has at least %d present traits", least)
+	}
+
+	taken, found := 0.0, 0
+	likeliest(options, func(digits []int, weight float64) bool {
+		present := 0
+		for d, o := range digits {
+			present += len(options[d][o].files)
+		}
+		if present < least {
+			return true
+		}
+		found++
+		if found == nftCount {
+			return false
+		}
+		taken += weight
+		return true
+	})
+
+	if found < nftCount {
+		return fmt.Errorf("NFT_COUNT is %d but the layers only allow %d unique combinations", nftCount, found)
+	}
+	left := (total - taken) / total
+	if left <= 0 || 1/left > feasibilityWarnAt {
+		draws := "more than " + strconv.Itoa(maxRerolls)
+		if left > 0 && 1/left <= maxRerolls {
+			draws = fmt.Sprintf("about %.0f", 1/left)
+		}
+		log.Printf("Warning: with these absence probabilities the last of the %d NFTs need %s draws each to find an unused combination, lower NFT_COUNT or the DIR<n>_ABSENCE values (%s)", nftCount, draws, absenceSummary(dirs))
+	}
+	return nil
+}
+
+// validMass returns the probability that a draw has at least least present
+// layers, from the distribution of the number of present layers.
+func validMass(options [][]layerOption, least int) float64 {
+	dist := map[int]float64{0: 1}
+	for _, dirOptions := range options {
+		next := map[int]float64{}
+		for present, p := range dist {
+			for _, option := range dirOptions {
+				next[present+len(option.files)] += p * option.weight
+			}
+		}
+		dist = next
+	}
+
+	mass := 0.0
+	for present, p := range dist {
+		if present >= least {
+			mass += p
+		}
+	}
+	return mass
+}
+
+// likeliest calls fn with the combinations of options, whose directory
+// options are sorted by descending weight, from the likeliest down until fn
+// returns false. Each combination is reached from the one with its last
+// non-zero digit one lower, so every combination is visited once.
+func likeliest(options [][]layerOption, fn func(digits []int, weight float64) bool) {
+	weightOf := func(digits []int) float64 {
+		weight := 1.0
+		for d, o := range digits {
+			weight *= options[d][o].weight
+		}
+		return weight
+	}
+
+	queue := &combinationQueue{}
+	start := make([]int, len(options))
+	heap.Push(queue, queuedCombination{digits: start, weight: weightOf(start)})
+	for queue.Len() > 0 {
+		c := heap.Pop(queue).(queuedCombination)
+		if !fn(c.digits, c.weight) {
+			return
+		}
+
+		last := 0
+		for d := range c.digits {
+			if c.digits[d] > 0 {
+				last = d
+			}
+		}
+		for d := last; d < len(options); d++ {
+			if c.digits[d]+1 >= len(options[d]) {
+				continue
+			}
+			next := append([]int{}, c.digits...)
+			next[d]++
+			heap.Push(queue, queuedCombination{digits: next, weight: weightOf(next)})
+		}
+	}
+}
+
+type queuedCombination struct {
+	digits []int
+	weight float64
+}
+
+// combinationQueue is a max-heap of combinations by weight.
+type combinationQueue []queuedCombination
+
+func (q combinationQueue) Len() int           { return len(q) }
+func (q combinationQueue) Less(a, b int) bool { return q[a].weight > q[b].weight }
+func (q combinationQueue) Swap(a, b int)      { q[a], q[b] = q[b], q[a] }
+func (q *combinationQueue) Push(x any)        { *q = append(*q, x.(queuedCombination)) }
+func (q *combinationQueue) Pop() any {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
+
+func absenceSummary(dirs []LayerDir) string {
+	var parts []string
+	for _, dir := range dirs {
+		if dir.Absence > 0 {
+			parts = append(parts, fmt.Sprintf("%s_ABSENCE=%g", dir.Key, dir.Absence))
+		}
+	}
+	if len(parts) == 0 {
+		return "none set"
+	}
+	return strings.Join(parts, ", ")
+}
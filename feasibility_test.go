@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFeasibility(t *testing.T) {
+	// Three layers left out of 90% of the NFTs leave 26 combinations with
+	// a present trait. The 6 with a single trait take 90% of the draws, the
+	// 12 with two 10% and the 8 with all three under 0.4%.
+	tests := []struct {
+		name      string
+		minTraits string
+		nftCount  int
+		// warn is the expected warning, none if empty
+		warn string
+		err  string
+	}{
+		{"single traits", "0", 6, "", ""},
+		{"last needs 83 draws", "0", 18, "", ""},
+		{"last needs 271 draws", "0", 19, "need about 271 draws each", ""},
+		{"every combination", "0", 26, "need more than 1000 draws each", ""},
+		{"one too many", "0", 27, "", "NFT_COUNT is 27 but the layers only allow 26 unique combinations"},
+		{"two traits, last needs 75 draws", "2", 18, "", ""},
+		{"two traits, last needs 112 draws", "2", 19, "need about 112 draws each", ""},
+		{"two traits, one too many", "2", 21, "", "NFT_COUNT is 21 but the layers only allow 20 unique combinations"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			var dirs []LayerDir
+			for d, trait := range []string{"Hat", "Glasses", "Pet"} {
+				key := fmt.Sprintf("DIR%d", d+1)
+				path := filepath.Join(work, trait)
+				writeLayers(t, path, "a.png", "b.png")
+				t.Setenv(key+"_ABSENCE", "0.9")
+				dirs = append(dirs, newLayerDir(key, path))
+			}
+			setFlag(t, "min-traits", tt.minTraits)
+			logged := captureLog(t)
+
+			err := checkFeasibility(dirs, tt.nftCount)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tt.warn == "" && logged.Len() > 0:
+				t.Errorf("unexpected warning: %s", logged)
+			case tt.warn != "" && !strings.Contains(logged.String(), tt.warn):
+				t.Errorf("warning doesn't say %q: %q", tt.warn, logged)
+			}
+		})
+	}
+}
@@ -1,5 +1,15 @@
 module layer-mixer.com
 
-go 1.20
+go 1.22.0
 
-require github.com/joho/godotenv v1.5.1
+require (
+	github.com/gen2brain/avif v0.3.2
+	github.com/joho/godotenv v1.5.1
+	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+)
+
+require (
+	github.com/ebitengine/purego v0.7.1 // indirect
+	github.com/tetratelabs/wazero v1.9.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+)
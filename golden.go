@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var goldenCheck = flag.String("golden-check", "", "regenerate the collection in this directory from its recipe.json into a temporary directory and fail naming every token whose files drifted")
+
+// runGoldenCheck regenerates the -golden-check directory from its recipe,
+// or the one of -from-recipe, and compares the two. The regeneration is
+// a run of the command with the same arguments into a temporary directory,
+// so the directory is removed however that run ends.
+func runGoldenCheck() error {
+	recipe := *fromRecipe
+	if recipe == "" {
+		recipe = filepath.Join(*goldenCheck, "recipe.json")
+	}
+	tempDir, err := os.MkdirTemp("", "golden-check-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	outputDir := filepath.Join(tempDir, "out")
+	cmd := exec.Command(executable, append(os.Args[1:], "-golden-check=", "-from-recipe="+recipe)...)
+	cmd.Env = append(os.Environ(), "OUTPUT_DIR="+outputDir)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	err = cmd.Run()
+	if err != nil {
+		return fmt.Errorf("regenerating '%s' failed: %v", *goldenCheck, err)
+	}
+	return compareGolden(*goldenCheck, outputDir)
+}
+
+var tokenFileName = regexp.MustCompile(`^(\d+)\.`)
+
+// readTree returns the contents of every file below dir by slash separated
+// relative path.
+func readTree(dir string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	return files, err
+}
+
+// compareGolden compares the regenerated outputDir with the golden
+// directory file by file. Differences in token files are reported by token
+// index, any other file by name.
+func compareGolden(golden, outputDir string) error {
+	want, err := readTree(golden)
+	if err != nil {
+		return err
+	}
+	got, err := readTree(outputDir)
+	if err != nil {
+		return err
+	}
+
+	drifted := map[int]bool{}
+	var others []string
+	report := func(path, problem string) {
+		if match := tokenFileName.FindStringSubmatch(filepath.Base(path)); match != nil {
+			i, _ := strconv.Atoi(match[1])
+			drifted[i] = true
+			return
+		}
+		others = append(others, fmt.Sprintf("'%s' %s", path, problem))
+	}
+	for path, data := range want {
+		switch current, ok := got[path]; {
+		case !ok:
+			report(path, "is missing")
+		case !bytes.Equal(current, data):
+			report(path, "has changed")
+		}
+	}
+	for path := range got {
+		if _, ok := want[path]; !ok {
+			report(path, "was added")
+		}
+	}
+
+	if len(drifted) == 0 && len(others) == 0 {
+		fmt.Printf("Golden check passed, all %d files of '%s' match\n", len(want), golden)
+		return nil
+	}
+
+	var problems []string
+	if len(drifted) > 0 {
+		indexes := make([]int, 0, len(drifted))
+		for i := range drifted {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+		names := make([]string, len(indexes))
+		for n, i := range indexes {
+			names[n] = strconv.Itoa(i)
+		}
+		problems = append(problems, fmt.Sprintf("%d tokens drifted: %s", len(indexes), strings.Join(names, ", ")))
+	}
+	sort.Strings(others)
+	problems = append(problems, others...)
+	return errors.New("golden check of '" + golden + "' failed:\n  " + strings.Join(problems, "\n  "))
+}
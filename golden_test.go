@@ -0,0 +1,74 @@
+package main
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGoldenCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		// drift changes the golden directory as a changed pipeline would
+		// have made it
+		drift func(t *testing.T, golden string)
+		// report is what the check prints, passed is whether it passes
+		report string
+		passed bool
+	}{
+		{"matching", nil, "Golden check passed, all", true},
+		{"changed image", func(t *testing.T, golden string) {
+			writePNG(t, filepath.Join(golden, "4.png"), solid(4, 4, color.NRGBA{250, 0, 250, 255}))
+		}, "1 tokens drifted: 4", false},
+		{"changed images and metadata", func(t *testing.T, golden string) {
+			writePNG(t, filepath.Join(golden, "2.png"), solid(4, 4, color.NRGBA{250, 0, 250, 255}))
+			writeFile(t, filepath.Join(golden, "6.json"), "{}")
+			writeFile(t, filepath.Join(golden, "2.json"), "{}")
+		}, "2 tokens drifted: 2, 6", false},
+		{"missing token", func(t *testing.T, golden string) {
+			if err := os.Remove(filepath.Join(golden, "5.png")); err != nil {
+				t.Fatal(err)
+			}
+		}, "1 tokens drifted: 5", false},
+		{"extra token", func(t *testing.T, golden string) {
+			writeFile(t, filepath.Join(golden, "7.json"), "{}")
+		}, "1 tokens drifted: 7", false},
+		{"other file", func(t *testing.T, golden string) {
+			writeFile(t, filepath.Join(golden, "manifest.json"), "{}")
+		}, "'manifest.json' has changed", false},
+		{"changed layer file", func(t *testing.T, golden string) {
+			writePNG(t, filepath.Join(filepath.Dir(golden), "2 Bird", "wren.png"), solid(4, 4, color.NRGBA{1, 2, 3, 255}))
+		}, "'Bird/wren.png' has changed", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "dawn.png", "dusk.png", "noon.png")
+			writeLayers(t, filepath.Join(work, "2 Bird"), "crow.png", "gull.png", "wren.png")
+			env := []string{"DIR1=1 Background", "DIR2=2 Bird", "NFT_COUNT=6"}
+			mustRunMixer(t, work, append(env, "OUTPUT_DIR=golden"), "-seed", "17")
+			if tt.drift != nil {
+				tt.drift(t, filepath.Join(work, "golden"))
+			}
+
+			// The collection is regenerated below TMPDIR, which must be
+			// left empty whether the check passes or fails
+			tmp := filepath.Join(work, "tmp")
+			if err := os.Mkdir(tmp, 0755); err != nil {
+				t.Fatal(err)
+			}
+			out, err := runMixer(t, work, append(env, "TMPDIR="+tmp), "-golden-check", "golden")
+			if passed := err == nil; passed != tt.passed {
+				t.Fatalf("passed %v, want %v:\n%s", passed, tt.passed, out)
+			}
+			if !strings.Contains(out, tt.report) {
+				t.Errorf("output doesn't say %q:\n%s", tt.report, out)
+			}
+			if entries, err := os.ReadDir(tmp); err != nil || len(entries) > 0 {
+				t.Errorf("the temporary directory holds %v (%v)", entries, err)
+			}
+		})
+	}
+}
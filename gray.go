@@ -0,0 +1,69 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GrayHandling configures what happens to layers stored as grayscale PNGs,
+// which are opaque and would cover everything below them.
+type GrayHandling struct {
+	// Mode is "rgba" to convert to color, "mask" to use the gray level as
+	// the alpha of Tint, or empty to composite the image as it is.
+	Mode string
+	Tint color.NRGBA
+}
+
+// getGrayHandling reads <prefix>_GRAY and <prefix>_TINT (RRGGBB, white by
+// default).
+func getGrayHandling(prefix string) GrayHandling {
+	handling := GrayHandling{Mode: os.Getenv(prefix + "_GRAY"), Tint: color.NRGBA{255, 255, 255, 255}}
+	if handling.Mode != "" && handling.Mode != "rgba" && handling.Mode != "mask" {
+		log.Fatalf("Invalid %s_GRAY value '%s', expected rgba or mask", prefix, handling.Mode)
+	}
+
+	if tint := os.Getenv(prefix + "_TINT"); tint != "" {
+		rgb, err := strconv.ParseUint(strings.TrimPrefix(tint, "#"), 16, 32)
+		if err != nil || len(strings.TrimPrefix(tint, "#")) != 6 {
+			log.Fatalf("Invalid %s_TINT value '%s', expected RRGGBB", prefix, tint)
+		}
+		handling.Tint = color.NRGBA{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb), 255}
+	}
+	return handling
+}
+
+// convertGray applies the handling to image.Gray and image.Gray16 layers
+// and returns any other image unchanged.
+func convertGray(img image.Image, handling GrayHandling) image.Image {
+	switch img.(type) {
+	case *image.Gray, *image.Gray16:
+	default:
+		return img
+	}
+
+	bounds := img.Bounds()
+	converted := image.NewNRGBA(bounds)
+
+	switch handling.Mode {
+	case "rgba":
+		draw.Draw(converted, bounds, img, bounds.Min, draw.Src)
+	case "mask":
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				level := color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+				c := handling.Tint
+				c.A = level
+				converted.SetNRGBA(x, y, c)
+			}
+		}
+	default:
+		return img
+	}
+
+	return converted
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+)
+
+func TestGrayLayers(t *testing.T) {
+	tests := []struct {
+		name     string
+		handling GrayHandling
+		// want are the composited pixels over a red background where the
+		// gray asset is white, black and mid gray
+		want [3]color.NRGBA
+	}{
+		{"as is", GrayHandling{}, [3]color.NRGBA{{255, 255, 255, 255}, {0, 0, 0, 255}, {128, 128, 128, 255}}},
+		{"converted to rgba", GrayHandling{Mode: "rgba"}, [3]color.NRGBA{{255, 255, 255, 255}, {0, 0, 0, 255}, {128, 128, 128, 255}}},
+		{"white mask", GrayHandling{Mode: "mask", Tint: color.NRGBA{255, 255, 255, 255}}, [3]color.NRGBA{{255, 255, 255, 255}, {255, 0, 0, 255}, {255, 128, 128, 255}}},
+		{"tinted mask", GrayHandling{Mode: "mask", Tint: color.NRGBA{0, 0, 255, 255}}, [3]color.NRGBA{{0, 0, 255, 255}, {255, 0, 0, 255}, {127, 0, 128, 255}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			gray := image.NewGray(image.Rect(0, 0, 3, 1))
+			gray.SetGray(0, 0, color.Gray{255})
+			gray.SetGray(1, 0, color.Gray{0})
+			gray.SetGray(2, 0, color.Gray{128})
+			writePNG(t, filepath.Join(root, "Pattern", "stripes.png"), gray)
+			writePNG(t, filepath.Join(root, "Background", "red.png"), solid(3, 1, color.NRGBA{255, 0, 0, 255}))
+
+			layers := []Layer{
+				{Name: "red.png", Trait: "Background", Path: filepath.Join(root, "Background", "red.png")},
+				{Name: "stripes.png", Trait: "Pattern", Path: filepath.Join(root, "Pattern", "stripes.png"), Gray: tt.handling},
+			}
+			if err := loadLayers(layers); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := layers[1].Image.(*image.Gray); ok != (tt.handling.Mode == "") {
+				t.Errorf("decoded as %T", layers[1].Image)
+			}
+
+			img := combineLayers(layers)
+			for x, want := range tt.want {
+				if got := color.NRGBAModel.Convert(img.At(x, 0)).(color.NRGBA); !near(got, want) {
+					t.Errorf("pixel %d is %v, want %v", x, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGrayMaskRecolor(t *testing.T) {
+	// The same mask file takes the tint of each directory that uses it
+	root := t.TempDir()
+	mask := image.NewGray(image.Rect(0, 0, 2, 2))
+	mask.SetGray(0, 0, color.Gray{255})
+	writePNG(t, filepath.Join(root, "mask.png"), mask)
+
+	for _, tint := range []color.NRGBA{{255, 0, 0, 255}, {0, 200, 100, 255}} {
+		layers := []Layer{{Name: "mask.png", Trait: "Glow", Path: filepath.Join(root, "mask.png"), Gray: GrayHandling{Mode: "mask", Tint: tint}}}
+		if err := loadLayers(layers); err != nil {
+			t.Fatal(err)
+		}
+		if got := color.NRGBAModel.Convert(layers[0].Image.At(0, 0)); got != tint {
+			t.Errorf("masked pixel is %v, want %v", got, tint)
+		}
+		if _, _, _, a := layers[0].Image.At(1, 1).RGBA(); a != 0 {
+			t.Errorf("black mask pixel has alpha %d", a)
+		}
+	}
+}
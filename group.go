@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// getLayerGroups returns the directories files of dir are drawn from. A
+// DIR<n>_GROUPED directory holds one subdirectory per sub-style, named
+// style#weight like files, whose members all share the settings and
+// trait_type of dir. Any other directory is its own single group.
+func getLayerGroups(dir LayerDir) ([]LayerDir, error) {
+	if !dir.Grouped {
+		return []LayerDir{dir}, nil
+	}
+
+	entries, err := readLayerDir(dir.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []LayerDir
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		group := dir
+		group.Path = filepath.Join(dir.Path, entry.Name())
+		group.Grouped = false
+		groups = append(groups, group)
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("%s is grouped but '%s' has no subdirectories", dir.Key, dir.Path)
+	}
+	return groups, nil
+}
+
+// pickGroup draws one group of dir by the weights of the subdirectory names.
+func pickGroup(rng Randomizer, dir LayerDir) (LayerDir, error) {
+	if !dir.Grouped {
+		return dir, nil
+	}
+	groups, err := getLayerGroups(dir)
+	if err != nil {
+		return dir, err
+	}
+
+	names := make([]string, len(groups))
+	for g, group := range groups {
+		names[g] = filepath.Base(group.Path)
+	}
+	g := pickWeighted(rng, getFileWeights(names))
+	if g < 0 {
+		return dir, fmt.Errorf("%s has no subdirectory with a weight above 0", dir.Key)
+	}
+	return groups[g], nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestGroupedDirectory(t *testing.T) {
+	tests := []struct {
+		name string
+		// files per sub-style directory
+		groups map[string][]string
+		// want is the expected share of every attribute value
+		want map[string]float64
+	}{
+		{"weighted groups and members",
+			map[string][]string{"casual#3": {"tee.png", "hoodie#3.png"}, "formal": {"suit.png", "tux.png"}},
+			map[string]float64{"tee": 0.1875, "hoodie": 0.5625, "suit": 0.125, "tux": 0.125}},
+		{"even groups, uneven sizes",
+			map[string][]string{"a_street": {"cap.png"}, "b_beach": {"hat.png", "visor.png", "scarf.png"}},
+			map[string]float64{"cap": 0.5, "hat": 1.0 / 6, "visor": 1.0 / 6, "scarf": 1.0 / 6}},
+		{"zero weight group",
+			map[string][]string{"party#0": {"tiara.png"}, "daily": {"cap.png", "scarf#2.png"}},
+			map[string]float64{"cap": 1.0 / 3, "scarf": 2.0 / 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := filepath.Join(t.TempDir(), "3 Outfit")
+			for group, files := range tt.groups {
+				writeLayers(t, filepath.Join(root, group), files...)
+			}
+			t.Setenv("DIR1_GROUPED", "true")
+			dirs := []LayerDir{newLayerDir("DIR1", root)}
+
+			const draws = 6000
+			counts := map[string]int{}
+			for i := 1; i <= draws; i++ {
+				layers, err := selectRandomLayers(tokenRand(i), dirs)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// One attribute named after the parent directory
+				attrs := buildMetadata(i, layers).Attributes
+				if len(attrs) != 1 || attrs[0].TraitType != "Outfit" {
+					t.Fatalf("token %d has attributes %+v, want one Outfit", i, attrs)
+				}
+				counts[attrs[0].Value]++
+			}
+			for value, share := range tt.want {
+				if got := float64(counts[value]) / draws; math.Abs(got-share) > 0.025 {
+					t.Errorf("%s drawn %.3f of the time, want %.3f", value, got, share)
+				}
+			}
+			for value := range counts {
+				if _, ok := tt.want[value]; !ok {
+					t.Errorf("drew %s %d times", value, counts[value])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// runMainEnv makes the test binary act as the layer-mixer command, so a
+// test can run a whole generation (and its log.Fatal exits) in a child
+// process, see runMixer.
+const runMainEnv = "LAYER_MIXER_RUN_MAIN"
+
+// reverseReadDirEnv makes the command read directories through
+// reversedSource, for tests of ReadDir order independence.
+const reverseReadDirEnv = "LAYER_MIXER_REVERSE_READDIR"
+
+// reversedSource lists every directory in reverse name order.
+type reversedSource struct{ LayerSource }
+
+func (s reversedSource) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := s.LayerSource.ReadDir(name)
+	slices.Reverse(entries)
+	return entries, err
+}
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) == "1" {
+		if os.Getenv(reverseReadDirEnv) == "1" {
+			layerSource = reversedSource{layerSource}
+		}
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMixer runs the command in workDir with env added to the environment
+// and returns its combined output. An empty .env is created there as
+// main requires one.
+func runMixer(t *testing.T, workDir string, env []string, args ...string) (string, error) {
+	t.Helper()
+	if _, err := os.Stat(filepath.Join(workDir, ".env")); os.IsNotExist(err) {
+		writeFile(t, filepath.Join(workDir, ".env"), "")
+	}
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Dir = workDir
+	cmd.Env = append(append(os.Environ(), runMainEnv+"=1"), env...)
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// mustRunMixer is runMixer failing the test if the command fails.
+func mustRunMixer(t *testing.T, workDir string, env []string, args ...string) string {
+	t.Helper()
+	out, err := runMixer(t, workDir, env, args...)
+	if err != nil {
+		t.Fatalf("layer-mixer %v: %v\n%s", args, err, out)
+	}
+	return out
+}
+
+// setFlag sets a command line flag for the rest of the test.
+func setFlag(t *testing.T, name, value string) {
+	t.Helper()
+	f := flag.Lookup(name)
+	if f == nil {
+		t.Fatalf("no flag -%s", name)
+	}
+	old := f.Value.String()
+	if err := flag.Set(name, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { flag.Set(name, old) })
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writePNG encodes img to path, creating its directory.
+func writePNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// solid returns a w x h image filled with c.
+func solid(w, h int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// writeLayers writes one small translucent layer file per name into dir,
+// each in its own color, so every combination composites to a different
+// image.
+func writeLayers(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for n, name := range names {
+		level := uint8(40 + n*200/len(names))
+		writePNG(t, filepath.Join(dir, name), solid(4, 4, color.NRGBA{level, level, 255 - level, 160}))
+	}
+}
+
+func readPNG(t *testing.T, path string) image.Image {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func readJSON(t *testing.T, path string, v any) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+}
+
+// captureLog collects what the log package prints for the rest of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+// mustReadTree is readTree failing the test on an error.
+func mustReadTree(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	files, err := readTree(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// diffTrees reports every file that differs between two readTree results.
+func diffTrees(t *testing.T, got, want map[string][]byte) {
+	t.Helper()
+	for name, data := range want {
+		if other, ok := got[name]; !ok {
+			t.Errorf("%s is missing", name)
+		} else if !bytes.Equal(other, data) {
+			t.Errorf("%s differs", name)
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("%s is unexpected", name)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"flag"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"io"
+)
+
+var interlace = flag.Bool("interlace", false, "write Adam7 interlaced PNGs for progressive loading")
+
+// adam7 lists the x/y start offsets and strides of the seven Adam7 passes.
+var adam7 = [7][4]int{
+	{0, 0, 8, 8},
+	{4, 0, 8, 8},
+	{0, 4, 4, 8},
+	{2, 0, 4, 4},
+	{0, 2, 2, 4},
+	{1, 0, 2, 2},
+	{0, 1, 1, 2},
+}
+
+// encodeInterlacedPNG writes img as an 8-bit RGBA, Adam7 interlaced PNG.
+// The standard library encoder can only write non-interlaced images.
+func encodeInterlacedPNG(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(pngSignature); err != nil {
+		return err
+	}
+
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(width))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(height))
+	ihdr[8] = 8  // bit depth
+	ihdr[9] = 6  // color type RGBA
+	ihdr[12] = 1 // Adam7 interlace
+	if err := writeChunk(bw, "IHDR", ihdr); err != nil {
+		return err
+	}
+
+	var data bytes.Buffer
+	zw, err := zlib.NewWriterLevel(&data, zlib.BestCompression)
+	if err != nil {
+		return err
+	}
+
+	for _, pass := range adam7 {
+		x0, y0, dx, dy := pass[0], pass[1], pass[2], pass[3]
+		if x0 >= width || y0 >= height {
+			continue
+		}
+		rowLen := 4 * ((width - x0 + dx - 1) / dx)
+
+		// The filters of each pass only see the previous row of that pass
+		prev := make([]byte, rowLen)
+		row := make([]byte, rowLen)
+		for y := y0; y < height; y += dy {
+			i := 0
+			for x := x0; x < width; x += dx {
+				c := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+				row[i], row[i+1], row[i+2], row[i+3] = c.R, c.G, c.B, c.A
+				i += 4
+			}
+
+			if _, err := zw.Write(filterRow(row, prev)); err != nil {
+				return err
+			}
+			prev, row = row, prev
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := writeChunk(bw, "IDAT", data.Bytes()); err != nil {
+		return err
+	}
+	if err := writeChunk(bw, "IEND", nil); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// filterRow returns the filter type byte and filtered row, using whichever
+// of the five PNG filters gives the smallest sum of absolute differences.
+func filterRow(row, prev []byte) []byte {
+	const bpp = 4
+
+	best := make([]byte, len(row)+1)
+	candidate := make([]byte, len(row)+1)
+	bestSum := -1
+
+	for filter := byte(0); filter < 5; filter++ {
+		candidate[0] = filter
+		sum := 0
+		for i, v := range row {
+			var left, up, upLeft byte
+			if i >= bpp {
+				left = row[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up = prev[i]
+
+			var predicted byte
+			switch filter {
+			case 1:
+				predicted = left
+			case 2:
+				predicted = up
+			case 3:
+				predicted = byte((int(left) + int(up)) / 2)
+			case 4:
+				predicted = paeth(left, up, upLeft)
+			}
+			f := v - predicted
+			candidate[i+1] = f
+
+			if f < 128 {
+				sum += int(f)
+			} else {
+				sum += 256 - int(f)
+			}
+		}
+
+		if bestSum < 0 || sum < bestSum {
+			bestSum = sum
+			best, candidate = candidate, best
+		}
+	}
+
+	return best
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func writeChunk(w io.Writer, chunkType string, data []byte) error {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(len(data)))
+	copy(header[4:], chunkType)
+
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	footer := make([]byte, 4)
+	binary.BigEndian.PutUint32(footer, crc.Sum32())
+
+	for _, b := range [][]byte{header, data, footer} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"testing"
+)
+
+func TestInterlacedPNG(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		interlace     bool
+	}{
+		{"single pixel", 1, 1, true},
+		{"smaller than a pass", 3, 5, true},
+		{"odd size", 17, 9, true},
+		{"several blocks", 32, 24, true},
+		{"not interlaced", 17, 9, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rng := rand.New(rand.NewSource(int64(tt.width * tt.height)))
+			img := image.NewNRGBA(image.Rect(0, 0, tt.width, tt.height))
+			for i := range img.Pix {
+				img.Pix[i] = uint8(rng.Intn(256))
+			}
+
+			var buf bytes.Buffer
+			if err := encodeImage(&buf, img, "png", WithInterlace(tt.interlace)); err != nil {
+				t.Fatal(err)
+			}
+
+			// The interlace method is the last byte of the IHDR data,
+			// after the signature, the chunk length and type and 12 bytes
+			data := buf.Bytes()
+			if string(data[12:16]) != "IHDR" {
+				t.Fatalf("first chunk is %q", data[12:16])
+			}
+			want := byte(0)
+			if tt.interlace {
+				want = 1
+			}
+			if got := data[8+8+12]; got != want {
+				t.Errorf("interlace method %d, want %d", got, want)
+			}
+
+			decoded, err := png.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Bounds() != img.Bounds() {
+				t.Fatalf("decoded %v, want %v", decoded.Bounds(), img.Bounds())
+			}
+			for y := 0; y < tt.height; y++ {
+				for x := 0; x < tt.width; x++ {
+					if got := color.NRGBAModel.Convert(decoded.At(x, y)); got != img.NRGBAAt(x, y) {
+						t.Fatalf("pixel %d,%d is %v, want %v", x, y, got, img.NRGBAAt(x, y))
+					}
+				}
+			}
+		})
+	}
+}
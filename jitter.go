@@ -0,0 +1,72 @@
+package main
+
+import (
+	"image"
+	"image/draw"
+	"math"
+)
+
+// JitterRanges configures per-token placement variation of a layer. Scale
+// is a relative offset (0.02 means up to 2% larger or smaller) and Offset is
+// in pixels along both axes.
+type JitterRanges struct {
+	Scale, Offset Range
+}
+
+// getJitterRanges reads <prefix>_JITTER_SCALE and <prefix>_JITTER_OFFSET.
+func getJitterRanges(prefix string) JitterRanges {
+	return JitterRanges{
+		Scale:  getRange(prefix + "_JITTER_SCALE"),
+		Offset: getRange(prefix + "_JITTER_OFFSET"),
+	}
+}
+
+func (r JitterRanges) enabled() bool {
+	return r != JitterRanges{}
+}
+
+// Jitter is the scale and position change applied when drawing a layer.
+type Jitter struct {
+	Scale float64 `json:"scale"`
+	X     int     `json:"x"`
+	Y     int     `json:"y"`
+}
+
+func (r JitterRanges) drawJitter(rng Randomizer) *Jitter {
+	return &Jitter{
+		Scale: 1 + math.Round(r.Scale.draw(rng)*1000)/1000,
+		X:     int(math.Round(r.Offset.draw(rng))),
+		Y:     int(math.Round(r.Offset.draw(rng))),
+	}
+}
+
+// drawLayer composites a layer onto dst, applying its jitter: the layer is
+// scaled around its center and then moved by the offset.
+func drawLayer(dst draw.Image, layer Layer, op draw.Op) {
+	img := layer.Image
+	bounds := dst.Bounds()
+
+	if layer.Jitter == nil {
+		draw.Draw(dst, bounds, img, image.Point{}, op)
+		return
+	}
+
+	src := img.Bounds()
+	if layer.Jitter.Scale != 1 {
+		w := int(math.Round(float64(src.Dx()) * layer.Jitter.Scale))
+		h := int(math.Round(float64(src.Dy()) * layer.Jitter.Scale))
+		scaled := resizeImage(img, w, h)
+
+		// Keep the scaled layer centered on the original
+		min := src.Min.Add(image.Pt((src.Dx()-w)/2, (src.Dy()-h)/2))
+		img = scaled
+		src = scaled.Bounds().Add(min)
+	}
+
+	target := src.Add(image.Pt(layer.Jitter.X, layer.Jitter.Y))
+	if op == draw.Src {
+		// Clear what the moved layer no longer covers
+		draw.Draw(dst, bounds, image.Transparent, image.Point{}, draw.Src)
+	}
+	draw.Draw(dst, target, img, img.Bounds().Min, op)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestDrawJitter(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges JitterRanges
+	}{
+		{"scale only", JitterRanges{Scale: Range{-0.05, 0.05}}},
+		{"offset only", JitterRanges{Offset: Range{-3, 3}}},
+		{"both", JitterRanges{Scale: Range{-0.02, 0.02}, Offset: Range{-10, 10}}},
+		{"asymmetric", JitterRanges{Scale: Range{0, 0.1}, Offset: Range{1, 4}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := map[Jitter]bool{}
+			for i := 1; i <= 200; i++ {
+				j := tt.ranges.drawJitter(newRandomizer(deriveSeed(5, i)))
+				again := tt.ranges.drawJitter(newRandomizer(deriveSeed(5, i)))
+				if *j != *again {
+					t.Fatalf("token %d: same seed drew %+v and %+v", i, *j, *again)
+				}
+
+				if j.Scale < 1+tt.ranges.Scale.Min || j.Scale > 1+tt.ranges.Scale.Max {
+					t.Fatalf("token %d: scale %g outside %+v", i, j.Scale, tt.ranges.Scale)
+				}
+				for _, offset := range []int{j.X, j.Y} {
+					if float64(offset) < tt.ranges.Offset.Min || float64(offset) > tt.ranges.Offset.Max {
+						t.Fatalf("token %d: offset %d outside %+v", i, offset, tt.ranges.Offset)
+					}
+				}
+				seen[*j] = true
+			}
+			if len(seen) < 2 {
+				t.Errorf("every token drew %v", seen)
+			}
+		})
+	}
+}
+
+func TestDrawLayerJitter(t *testing.T) {
+	tests := []struct {
+		name   string
+		jitter *Jitter
+		// want is where the 2x2 dot at 5,5 ends up
+		want image.Rectangle
+	}{
+		{"no jitter", nil, image.Rect(5, 5, 7, 7)},
+		{"moved", &Jitter{Scale: 1, X: 2, Y: -1}, image.Rect(7, 4, 9, 6)},
+		{"moved back", &Jitter{Scale: 1, X: -5, Y: 3}, image.Rect(0, 8, 2, 10)},
+		{"doubled around the center", &Jitter{Scale: 2}, image.Rect(5, 5, 9, 9)},
+		{"doubled and moved", &Jitter{Scale: 2, X: -3, Y: 1}, image.Rect(2, 6, 6, 10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			layer := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+			draw.Draw(layer, image.Rect(5, 5, 7, 7), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+			dst := image.NewRGBA(image.Rect(0, 0, 10, 10))
+			drawLayer(dst, Layer{Image: layer, Jitter: tt.jitter}, draw.Src)
+
+			var got image.Rectangle
+			for y := 0; y < 10; y++ {
+				for x := 0; x < 10; x++ {
+					if dst.RGBAAt(x, y).A > 127 {
+						got = got.Union(image.Rect(x, y, x+1, y+1))
+					}
+				}
+			}
+			if got != tt.want {
+				t.Errorf("dot drawn at %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// LocalizedText is the name and description of a token in one language.
+type LocalizedText struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// expandTemplate replaces {index} in a NAME or DESCRIPTION template.
+func expandTemplate(template string, i int) string {
+	return strings.ReplaceAll(template, "{index}", strconv.Itoa(i))
+}
+
+// getLocales parses LOCALES, a comma separated list such as en,fr,pt-BR,
+// each listed once.
+func getLocales() []string {
+	value := os.Getenv("LOCALES")
+	if value == "" {
+		return nil
+	}
+
+	var locales []string
+	for _, locale := range strings.Split(value, ",") {
+		locale = strings.TrimSpace(locale)
+		if locale == "" {
+			log.Fatalf("Invalid LOCALES value '%s'", value)
+		}
+		if slices.Contains(locales, locale) {
+			log.Fatalf("Locale '%s' is listed twice in LOCALES", locale)
+		}
+		locales = append(locales, locale)
+	}
+	return locales
+}
+
+// localeEnv returns the variable holding the localized text of field, e.g.
+// NAME_PT_BR for pt-BR.
+func localeEnv(field, locale string) string {
+	return field + "_" + strings.ToUpper(strings.ReplaceAll(locale, "-", "_"))
+}
+
+// buildLocalization returns the localized texts of token i for every locale
+// in LOCALES. A locale without NAME_<LOCALE> or DESCRIPTION_<LOCALE> keeps
+// the default text.
+func buildLocalization(i int, name, description string) map[string]LocalizedText {
+	locales := getLocales()
+	if len(locales) == 0 {
+		return nil
+	}
+
+	localization := map[string]LocalizedText{}
+	for _, locale := range locales {
+		text := LocalizedText{Name: name, Description: description}
+		if template := os.Getenv(localeEnv("NAME", locale)); template != "" {
+			text.Name = expandTemplate(template, i)
+		}
+		if template := os.Getenv(localeEnv("DESCRIPTION", locale)); template != "" {
+			text.Description = expandTemplate(template, i)
+		}
+		localization[locale] = text
+	}
+	return localization
+}
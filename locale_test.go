@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLocalizedMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want map[string]LocalizedText
+	}{
+		{"no locales", map[string]string{}, nil},
+		{"every text localized", map[string]string{
+			"LOCALES": "fr, pt-BR", "NAME_FR": "Chat {index}", "DESCRIPTION_FR": "Un chat",
+			"NAME_PT_BR": "Gato {index}", "DESCRIPTION_PT_BR": "Um gato",
+		}, map[string]LocalizedText{
+			"fr":    {Name: "Chat 3", Description: "Un chat"},
+			"pt-BR": {Name: "Gato 3", Description: "Um gato"},
+		}},
+		{"missing texts keep the default", map[string]string{
+			"LOCALES": "en,de", "NAME_DE": "Katze {index}",
+		}, map[string]LocalizedText{
+			"en": {Name: "Cat 3", Description: "A cat"},
+			"de": {Name: "Katze 3", Description: "A cat"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NAME", "Cat {index}")
+			t.Setenv("DESCRIPTION", "A cat")
+			t.Setenv("LOCALES", "")
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			meta := buildMetadata(3, []Layer{{Name: "tabby.png", Trait: "Fur", Path: "tabby.png"}})
+			if meta.Name != "Cat 3" || meta.Description != "A cat" {
+				t.Errorf("default texts %q, %q", meta.Name, meta.Description)
+			}
+			if !reflect.DeepEqual(meta.Localization, tt.want) {
+				t.Errorf("localization %+v, want %+v", meta.Localization, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidLocales(t *testing.T) {
+	tests := []struct {
+		locales string
+		err     string
+	}{
+		{"en,fr,en", "Locale 'en' is listed twice in LOCALES"},
+		{"en, ,fr", "Invalid LOCALES value 'en, ,fr'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locales, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Fur"), "tabby.png", "calico.png")
+			env := []string{"DIR1=1 Fur", "NFT_COUNT=2", "OUTPUT_DIR=out", "LOCALES=" + tt.locales}
+			out, err := runMixer(t, work, env)
+			if err == nil || !strings.Contains(out, tt.err) {
+				t.Fatalf("got %v, want %q:\n%s", err, tt.err, out)
+			}
+			// Rejected at startup, before any token is written
+			if _, err := os.Stat(filepath.Join(work, "out")); !os.IsNotExist(err) {
+				t.Errorf("the output directory was created")
+			}
+		})
+	}
+}
@@ -1,98 +1,415 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"flag"
 	"fmt"
 	"image"
 	"image/draw"
 	"image/png"
-	"io/ioutil"
 	"log"
-	"math/rand"
+	"math"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/joho/godotenv"
 )
 
+var seed = flag.Int64("seed", 0, "random seed making the collection reproducible (0 picks one from the current time)")
+
+// seedSource is where the seed came from when -seed wasn't given.
+var seedSource = "default"
+var minTraits = flag.Int("min-traits", 0, "re-roll NFTs that have fewer than N present (non-None) traits")
+var layersLimit = flag.Int("layers-limit", 0, "debug: composite only the bottom N present layers of every NFT (0 draws all)")
+var chunkSize = flag.Int("chunk-size", 0, "split output into batch_NNNN subdirectories of N files each (0 disables chunking)")
+var maxDepth = flag.Int("max-depth", 0, "fail before generating if any file would be more than N levels below OUTPUT_DIR, counting the file itself (0 disables)")
+
 type Layer struct {
-	Name  string
-	Image image.Image
+	Name  string      `json:"name"`
+	Trait string      `json:"trait_type"`
+	Path  string      `json:"path,omitempty"`
+	Image image.Image `json:"-"`
+	// Shift is the HSV color shift applied to the image after decoding.
+	Shift *ColorShift `json:"shift,omitempty"`
+	// Jitter is the scale and position change applied when drawing.
+	Jitter *Jitter `json:"jitter,omitempty"`
+	// Gray is how the layer is treated if it's a grayscale image.
+	Gray GrayHandling `json:"-"`
+	// Preprocess runs on the decoded file before it's shifted or drawn.
+	Preprocess Pipeline `json:"-"`
+}
+
+// noneTrait is the attribute value of an optional layer that was left out.
+const noneTrait = "None"
+
+// maxRerolls bounds how many times a selection is retried before giving up.
+const maxRerolls = 1000
+
+// LayerDir is a trait directory configured through a DIR<n> variable.
+type LayerDir struct {
+	Key  string
+	Path string
+	// Pick is the exact number of distinct files drawn from the directory
+	// for every NFT. The default of 1 selects a single trait.
+	Pick int
+	// Absence is the probability that the layer is left out entirely.
+	Absence float64
+	// HSV are the ranges a per-token color shift is drawn from.
+	HSV HSVRanges
+	// Jitter are the ranges per-token placement jitter is drawn from.
+	Jitter JitterRanges
+	// Gray is how grayscale files of the directory are composited.
+	Gray GrayHandling
+	// Preprocess is the pipeline every file of the directory goes through.
+	Preprocess Pipeline
+	// Grouped directories hold weighted sub-style subdirectories instead
+	// of layer files.
+	Grouped bool
+	// Values turn layer names into attribute values.
+	Values []ValueTransform
 }
 
 type LayerCache map[string]image.Image
 
-func readRandomLayersFromDirs(dirs []string) ([]Layer, error) {
+// deriveSeed mixes the run seed with a token index (splitmix64) so every
+// token draws from its own independent, reproducible stream.
+func deriveSeed(seed int64, i int) int64 {
+	z := uint64(seed) + uint64(i)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return int64(z ^ (z >> 31))
+}
+
+// tokenRand returns the random source used to select the layers of token i.
+func tokenRand(i int) Randomizer {
+	if reshuffled[i] {
+		return newRandomizer(reshuffleSeed(i))
+	}
+	return newRandomizer(deriveSeed(*seed, i))
+}
+
+// newLayer returns the layer of the file at path drawn from dir, carrying
+// the gray handling and preprocessing its directory declares.
+func newLayer(trait string, dir LayerDir, path string) Layer {
+	return Layer{Name: filepath.Base(path), Trait: trait, Path: path, Gray: dir.Gray, Preprocess: dir.Preprocess}
+}
+
+// selectRandomLayers picks the layer files of one NFT without decoding
+// them. Absent optional layers are kept as a "None" layer with no Path.
+func selectRandomLayers(rng Randomizer, dirs []LayerDir) ([]Layer, error) {
 	var layers []Layer
 
 	for _, dir := range dirs {
-		files, err := ioutil.ReadDir(dir)
+		trait := getTraitType(dir)
+
+		if dir.Absence > 0 && rng.Float64() < dir.Absence {
+			layers = append(layers, Layer{Name: noneTrait, Trait: trait})
+			continue
+		}
+
+		// Grouped directories first draw the sub-style to pick files from
+		parent := dir
+		dir, err := pickGroup(rng, dir)
 		if err != nil {
 			return nil, err
 		}
 
-		// Generate a random index within the range of the files slice
-		rand.Seed(time.Now().UnixNano())
-		randomIndex := rand.Intn(len(files))
+		files, err := listLayerFiles(dir)
+		if err != nil {
+			return nil, err
+		}
+		if dir.Pick > len(files) {
+			return nil, fmt.Errorf("%s needs %d layers but '%s' only has %d", dir.Key, dir.Pick, dir.Path, len(files))
+		}
 
-		file := files[randomIndex]
+		names := make([]string, len(files))
+		paths := make([]string, len(files))
+		for f, file := range files {
+			names[f] = file.Name()
+			paths[f] = filepath.Join(dir.Path, file.Name())
+		}
+		weights := getFileWeights(names)
+		if quotas != nil {
+			weights = quotas.reweight(parent, dir, paths, weights)
+		}
 
-		if !file.IsDir() {
-			f, err := os.Open(filepath.Join(dir, file.Name()))
-			if err != nil {
-				return nil, err
-			}
+		// Draw Pick distinct files by weight without replacement, keeping
+		// directory order so the same group members always stack the same way
+		picked := pickWithoutReplacement(rng, weights, dir.Pick)
+		if picked == nil {
+			return nil, fmt.Errorf("%s needs %d layers but fewer files in '%s' have a weight above 0", dir.Key, dir.Pick, dir.Path)
+		}
+		sort.Ints(picked)
 
-			img, err := png.Decode(f)
-			if err != nil {
-				return nil, err
+		// One shift per directory so every member of a group matches
+		var shift *ColorShift
+		if dir.HSV.enabled() {
+			shift = dir.HSV.drawShift(rng, trait)
+		}
+
+		for _, randomIndex := range picked {
+			layer := newLayer(trait, dir, paths[randomIndex])
+			layer.Shift = shift
+			if dir.Jitter.enabled() {
+				layer.Jitter = dir.Jitter.drawJitter(rng)
 			}
+			layers = append(layers, layer)
+		}
+	}
+
+	return layers, nil
+}
+
+// selectToken re-rolls selectRandomLayers for token i until the selection,
+// with its sticky traits applied, has at least -min-traits present layers.
+// A selection with every layer absent has no image, so it's always re-rolled.
+// The re-rolls are added to counts, a nil counts drops them.
+func selectToken(i int, rng Randomizer, dirs []LayerDir, counts *rerollCounts) ([]Layer, error) {
+	need := max(*minTraits, 1)
+	for attempt := 0; attempt < maxRerolls; attempt++ {
+		layers, err := selectRandomLayers(rng, dirs)
+		if err != nil {
+			return nil, err
+		}
+		layers, err = applySticky(i, layers, dirs)
+		if err != nil {
+			return nil, err
+		}
 
-			layers = append(layers, Layer{Name: file.Name(), Image: img})
+		if countPresent(layers) >= need {
+			return layers, nil
+		}
+		counts.add("min-traits")
+	}
+
+	return nil, fmt.Errorf("no combination with at least %d traits after %d attempts", need, maxRerolls)
+}
+
+func countPresent(layers []Layer) int {
+	n := 0
+	for _, layer := range layers {
+		if layer.Path != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// loadLayers decodes the image of every present layer.
+func loadLayers(layers []Layer) error {
+	if countPresent(layers) == 0 {
+		return errors.New("every layer of the combination is absent")
+	}
 
-			err = f.Close()
+	for i := range layers {
+		if layers[i].Path == "" {
+			continue
+		}
+
+		// A file without a color shift is the same for every token using
+		// it, so its scaled image is shared
+		size, resized := getTargetResolution()
+		if resized && layers[i].Shift == nil {
+			img, err := loadScaledLayer(layers[i], size)
 			if err != nil {
-				return nil, err
+				return err
 			}
+			layers[i].Image = img
+			continue
+		}
+
+		img, err := loadLayerImage(layers[i])
+		if err != nil {
+			return err
+		}
+		if shift := layers[i].Shift; shift != nil {
+			img = shiftHSV(img, shift.Hue, shift.Saturation, shift.Value)
 		}
+		if resized {
+			img = fitToResolution(img, size)
+		}
+		layers[i].Image = img
 	}
 
-	return layers, nil
+	return nil
 }
 
+// presentLayers returns the layers that have an image to composite.
+func presentLayers(layers []Layer) []Layer {
+	present := make([]Layer, 0, len(layers))
+	for _, layer := range layers {
+		if layer.Image != nil {
+			present = append(present, layer)
+		}
+	}
+	return present
+}
+
+// decodeLayer reads a layer PNG, converting grayscale images, normalizing
+// its color profile and cleaning its alpha if requested.
+func decodeLayer(path string, gray GrayHandling) (image.Image, error) {
+	data, err := layerSource.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	img = convertGray(img, gray)
+
+	if *normalizeProfiles {
+		profile, err := readColorProfile(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		img = normalizeProfile(img, profile)
+	}
+
+	return cleanLayerAlpha(img), nil
+}
+
+// drawnLayers returns the layers combineLayers composites: the present
+// ones, or only the first -layers-limit of them.
+func drawnLayers(layers []Layer) []Layer {
+	layers = presentLayers(layers)
+	if *layersLimit > 0 && *layersLimit < len(layers) {
+		layers = layers[:*layersLimit]
+	}
+	return layers
+}
+
+// renderToken returns the image of token i: its composited layers with the
+// -scatter sprites, cropped to the -mask, and the QR code drawn last so the
+// mask can't clip it.
+func renderToken(i int, layers []Layer) image.Image {
+	return drawQR(i, applyMask(drawScatter(i, combineLayers(layers))))
+}
+
+// combineLayers composites the drawnLayers bottom to top.
 func combineLayers(layers []Layer) image.Image {
+	layers = drawnLayers(layers)
 	bounds := layers[0].Image.Bounds()
 	combined := image.NewRGBA(bounds)
 
-	draw.Draw(combined, bounds, layers[0].Image, image.Point{}, draw.Src)
+	drawLayer(combined, layers[0], draw.Src)
 
 	for _, layer := range layers[1:] {
-		draw.Draw(combined, bounds, layer.Image, image.Point{}, draw.Over)
+		drawLayer(combined, layer, draw.Over)
 	}
 
 	return combined
 }
 
-func getDirNames() []string {
-	dirs := []string{}
+// compositeSteps composites the layers one at a time and returns the
+// intermediate image after each layer is drawn.
+func compositeSteps(layers []Layer) []image.Image {
+	layers = presentLayers(layers)
+	bounds := layers[0].Image.Bounds()
+	combined := image.NewRGBA(bounds)
+
+	steps := make([]image.Image, 0, len(layers))
+	for i, layer := range layers {
+		op := draw.Over
+		if i == 0 {
+			op = draw.Src
+		}
+		drawLayer(combined, layer, op)
+
+		step := image.NewRGBA(bounds)
+		copy(step.Pix, combined.Pix)
+		steps = append(steps, step)
+	}
+
+	return steps
+}
+
+var layerDirKey = regexp.MustCompile(`^DIR(\d+)$`)
+
+// getLayerDirs returns the DIR<n> trait directories ordered by n, which is
+// the order they are stacked in.
+func getLayerDirs() []LayerDir {
+	dirs := []LayerDir{}
+	order := map[string]int{}
 	for _, env := range os.Environ() {
-		if strings.HasPrefix(env, "DIR") {
-			pair := strings.SplitN(env, "=", 2)
-			dirs = append(dirs, os.Getenv(pair[0]))
+		pair := strings.SplitN(env, "=", 2)
+		match := layerDirKey.FindStringSubmatch(pair[0])
+		if match == nil {
+			continue
 		}
+		order[pair[0]], _ = strconv.Atoi(match[1])
+		dirs = append(dirs, newLayerDir(pair[0], os.Getenv(pair[0])))
 	}
+
+	sort.Slice(dirs, func(i, j int) bool {
+		return order[dirs[i].Key] < order[dirs[j].Key]
+	})
 	return dirs
 }
 
-func getNFTCount() int {
+// newLayerDir reads the settings of a trait directory from the variables
+// prefixed with its key, e.g. DIR4_PICK=2 draws exactly two distinct files
+// from DIR4 and DIR4_ABSENCE=0.3 leaves the layer out of 30% of the NFTs.
+// DIR4_HUE, DIR4_SATURATION and DIR4_VALUE give MIN:MAX ranges for a
+// per-token HSV color shift, DIR4_JITTER_SCALE and DIR4_JITTER_OFFSET the
+// same for small scale and position changes. DIR4_GRAY=rgba|mask and
+// DIR4_TINT=RRGGBB control how grayscale files are composited and
+// DIR4_PREPROCESS=resize:1000,outline:2,shadow:4 is run on every file once.
+// DIR4_GROUPED=true draws files from weighted subdirectories.
+func newLayerDir(key, path string) LayerDir {
+	dir := LayerDir{Key: key, Path: path, Pick: 1}
+	if pick := os.Getenv(key + "_PICK"); pick != "" {
+		n, err := strconv.Atoi(pick)
+		if err != nil || n < 1 {
+			log.Fatalf("Invalid %s_PICK value '%s'", key, pick)
+		}
+		dir.Pick = n
+	}
+	if absence := os.Getenv(key + "_ABSENCE"); absence != "" {
+		p, err := strconv.ParseFloat(absence, 64)
+		if err != nil || p < 0 || p >= 1 {
+			log.Fatalf("Invalid %s_ABSENCE value '%s'", key, absence)
+		}
+		dir.Absence = p
+	}
+	dir.HSV = getHSVRanges(key)
+	dir.Jitter = getJitterRanges(key)
+	dir.Gray = getGrayHandling(key)
+	dir.Preprocess = getPipeline(key)
+	dir.Values = getValueTransforms(key)
+	if grouped := os.Getenv(key + "_GROUPED"); grouped != "" {
+		b, err := strconv.ParseBool(grouped)
+		if err != nil {
+			log.Fatalf("Invalid %s_GROUPED value '%s'", key, grouped)
+		}
+		dir.Grouped = b
+	}
+	return dir
+}
+
+func getNFTCount() (int, error) {
 	nftCountStr := os.Getenv("NFT_COUNT")
+	if nftCountStr == "" {
+		return 0, errors.New("NFT_COUNT environment variable not set")
+	}
+
 	nftCount, err := strconv.Atoi(nftCountStr)
 	if err != nil {
-		log.Fatal(err) //"Invalid NFT_COUNT value")
+		return 0, fmt.Errorf("NFT_COUNT must be a whole number, got '%s'", nftCountStr)
+	}
+	if nftCount < 1 {
+		return 0, fmt.Errorf("NFT_COUNT must be at least 1, got %d", nftCount)
 	}
-	return nftCount
+	return nftCount, nil
 }
 
 func getOutputDir() string {
@@ -114,12 +431,16 @@ func createOutputDir(outputDir string) {
 	}
 }
 
+// getCacheKey identifies a combination of layers. Every name is qualified
+// by its trait_type and quoted, so same-named files of different
+// directories and names containing the separator can't collide. Renamed
+// files are keyed by their current name.
 func getCacheKey(layers []Layer) string {
 	layerNames := make([]string, len(layers))
 	for i, layer := range layers {
-		layerNames[i] = layer.Name
+		layerNames[i] = strconv.Quote(layer.Trait) + ":" + strconv.Quote(resolveAlias(layer.Trait, layer.Name))
 	}
-	cacheKey := strings.Join(layerNames, "-")
+	cacheKey := strings.Join(layerNames, ",")
 	return cacheKey
 }
 
@@ -128,22 +449,123 @@ func getFromCache(cache LayerCache, layers []Layer) (image.Image, bool) {
 	return combined, ok
 }
 
-func saveImageToFile(i int, img image.Image, outputDir string) {
-	outFileName := fmt.Sprintf("%d.png", i)
-	outFile, err := os.Create(filepath.Join(outputDir, outFileName))
+// getTokenDir returns the directory token i is written to, creating the
+// batch subdirectory when chunked output is enabled.
+func getTokenDir(outputDir string, i int) string {
+	if *chunkSize <= 0 {
+		return outputDir
+	}
+
+	// Tokens are numbered from 1, so batch_0001 holds 1..chunkSize
+	batch := (i-1) / *chunkSize + 1
+	dir := filepath.Join(outputDir, fmt.Sprintf("batch_%04d", batch))
+
+	err := os.MkdirAll(dir, 0755)
 	if err != nil {
 		log.Fatal(err)
 	}
+	return dir
+}
+
+// getOutputDepth returns how many levels below OUTPUT_DIR the deepest file
+// of the run is written, counting the file itself.
+func getOutputDepth() int {
+	// Batches, tier folders and thumbnails are all single level
+	// subdirectories
+	if *chunkSize > 0 || *splitTiers || *thumbnails > 0 {
+		return 2
+	}
+	return 1
+}
+
+// checkOutputDepth fails when the output options nest files deeper than
+// -max-depth.
+func checkOutputDepth() error {
+	if *maxDepth <= 0 {
+		return nil
+	}
+	if depth := getOutputDepth(); depth > *maxDepth {
+		return fmt.Errorf("the output options write files %d levels below OUTPUT_DIR, more than -max-depth %d", depth, *maxDepth)
+	}
+	return nil
+}
 
-	/* 	err = jpeg.Encode(outFile, img, &jpeg.Options{Quality: 90})
-	   	if err != nil {
-	   		log.Fatal(err)
-	   	} */
-	err = png.Encode(outFile, img)
+// getTokenPath returns the path of a file of token i relative to outputDir.
+func getTokenPath(outputDir string, i int, fileName string) string {
+	if *chunkSize <= 0 {
+		return fileName
+	}
+	rel, err := filepath.Rel(outputDir, filepath.Join(getTokenDir(outputDir, i), fileName))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return rel
+}
+
+// saveImageToFile writes the image of token i and returns its file name.
+func saveImageToFile(i int, img image.Image, outputDir string) string {
+	tokenDir := getTokenDir(outputDir, i)
+
+	buf := encodeBuffers.Get().(*bytes.Buffer)
+	defer encodeBuffers.Put(buf)
+	buf.Reset()
+
+	err := encodeImage(buf, img, getOutputFormat(), getOutputOptions()...)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	outFileName := fmt.Sprintf("%d%s", i, getFormatExtension(getOutputFormat()))
+	if *nameBy == "hash" {
+		outFileName = hashFileName(buf.Bytes())
+	}
+
+	err = os.WriteFile(filepath.Join(tokenDir, outFileName), buf.Bytes(), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return outFileName
+}
+
+// writeImage encodes img in the configured output format and writes it to
+// path in one call.
+func writeImage(path string, img image.Image) error {
+	buf := encodeBuffers.Get().(*bytes.Buffer)
+	defer encodeBuffers.Put(buf)
+	buf.Reset()
+
+	err := encodeImage(buf, img, getOutputFormat(), getOutputOptions()...)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+type imageJob struct {
+	i      int
+	img    image.Image
+	layers []Layer
+	meta   Metadata
+}
+
+type metaJob struct {
+	i      int
+	meta   Metadata
+	layers []Layer
+}
+
+// getWorkerCount reads a worker pool size from the environment, falling
+// back to def when it isn't set.
+func getWorkerCount(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		log.Fatalf("Invalid %s value '%s'", key, value)
+	}
+	return n
 }
 
 func handlePanic() {
@@ -158,56 +580,435 @@ func main() {
 	// Handle panics
 	defer handlePanic()
 
+	flag.Parse()
+
 	// Load environment variables from .env file
 	err := godotenv.Load()
 	if err != nil {
 		log.Fatal("Error loading .env file")
 	}
 
-	dirs := getDirNames()
-	nftCount := getNFTCount()
+	if *goldenCheck != "" {
+		err := runGoldenCheck()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var recipe Recipe
+	if *fromRecipe != "" {
+		recipe, err = applyRecipe()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Every mode draws and decodes layers, check how before any of them runs
+	if *cleanAlphaMode != "" && *cleanAlphaMode != "zero" && *cleanAlphaMode != "unpremultiply" {
+		log.Fatalf("Invalid -clean-alpha value '%s'", *cleanAlphaMode)
+	}
+	if *temperature < 0 || math.IsInf(*temperature, 0) || math.IsNaN(*temperature) {
+		log.Fatalf("Invalid -temperature value %g, it must be 0 or above", *temperature)
+	}
+	// LOCALES is read again for every token's metadata, check it once here
+	getLocales()
+
+	// Reshuffling keeps the rest of the run like resuming it
+	if *reshuffle != "" {
+		*resume = true
+	}
+	// Modes working on the tokens of an earlier run draw with its seed
+	if (*resume || *rerenderAffected != "") && *seed == 0 {
+		*seed, err = getManifestSeed(getOutputDir())
+		if err != nil {
+			log.Fatal(err)
+		}
+		seedSource = "manifest"
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+		seedSource = "time"
+	}
+	if !*dumpConfig {
+		fmt.Println("Seed:", *seed)
+	}
+
+	dirs := getLayerDirs()
 	outputDir := getOutputDir()
 
-	// Create the output directory
-	createOutputDir(outputDir)
+	if *assetBundle != "" {
+		bundle, err := openAssetBundle(*assetBundle)
+		if err != nil {
+			log.Fatal(err)
+		}
+		layerSource = fsSource{bundle}
+
+		if len(dirs) == 0 {
+			dirs, err = getBundleLayerDirs(bundle)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	err = loadAliases()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = loadDisplayValues(dirs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = loadCompanion(dirs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *fromRecipe != "" {
+		err := checkRecipe(recipe, dirs, outputDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *dumpConfig {
+		writeConfig(os.Stdout, dirs, outputDir)
+		return
+	}
+
+	if *sampleTraits != "" {
+		err := generateTraitSamples(*sampleTraits, dirs, outputDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *baseImage != "" {
+		err := generateVariations(*baseImage, *variations, outputDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *rerenderAffected != "" {
+		err := rerenderAffectedTokens(*rerenderAffected, dirs, outputDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *revealAnim > 0 {
+		err := saveRevealAnimation(*revealAnim, dirs, outputDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	nftCount, err := getNFTCount()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *estimateUnique > 0 {
+		err := printUniqueEstimate(*estimateUnique, dirs, nftCount)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *nameBy != "index" && *nameBy != "hash" {
+		log.Fatalf("Invalid -name-by value '%s'", *nameBy)
+	}
+	if *layersLimit < 0 {
+		log.Fatalf("Invalid -layers-limit value %d", *layersLimit)
+	}
+	if err := parseReshuffle(nftCount); err != nil {
+		log.Fatal(err)
+	}
+	if *revealStart != "" {
+		if _, err := getRevealStart(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := checkQROptions(); err != nil {
+		log.Fatal(err)
+	}
+	if err := checkScatterOptions(); err != nil {
+		log.Fatal(err)
+	}
+	if *thumbnails < 0 {
+		log.Fatalf("Invalid -thumbnails value %d", *thumbnails)
+	}
+	if *mask != "" && *mask != "circle" && *mask != "rounded" {
+		log.Fatalf("Invalid -mask value '%s'", *mask)
+	}
+	if *export != "" && *export != "graphql-json" {
+		log.Fatalf("Invalid -export value '%s'", *export)
+	}
+	if *splitTiers {
+		if _, err := parseTierPercentiles(*tierPercentiles); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if format := getOutputFormat(); !supportedFormat(format) {
+		log.Fatalf("Invalid OUTPUT_FORMAT value '%s'", format)
+	}
+	if *maxDepth < 0 {
+		log.Fatalf("Invalid -max-depth value %d", *maxDepth)
+	}
+	if err := checkOutputDepth(); err != nil {
+		log.Fatal(err)
+	}
+
+	err = checkTraitTypes(dirs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Warn about layers whose color profiles don't match
+	checkColorProfiles(dirs)
+
+	// Estimate the size of the collection before writing any of it
+	err = checkDiskUsage(dirs, nftCount, outputDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create the output directory, a resumed run continues in it
+	if !*resume {
+		createOutputDir(outputDir)
+	}
 
 	// Create a cache to store combined layers
 	cache := make(LayerCache)
 
-	done := make(chan bool)
+	// Count how often each layer file ends up in an NFT
+	usage := map[string]int{}
+	if *useQuotas {
+		quotas = newQuotaTracker(nftCount, usage)
+	}
+
+	imageWorkers := getWorkerCount("IMAGE_WORKERS", runtime.NumCPU())
+	metaWorkers := getWorkerCount("META_WORKERS", 2)
+
+	// Metadata of every written token
+	tokens := newTokenStore()
+
+	// manifest.json follows the written tokens, so an interrupted run can
+	// be resumed
+	manifest := newManifestWriter(outputDir)
+
+	// Content addressed file names of each token when -name-by hash
+	hashes := &hashIndex{}
+
+	imageJobs := make(chan imageJob, imageWorkers)
+	metaJobs := make(chan metaJob, metaWorkers)
+	var imageWG, metaWG sync.WaitGroup
+
+	// A panic in a worker fails its token instead of the whole run
+	panics := newPanicCollector()
+
+	// Image workers encode the PNGs and hand the metadata on to the
+	// metadata workers, so cheap JSON writes never wait behind encoding
+	for w := 0; w < imageWorkers; w++ {
+		imageWG.Add(1)
+		go func() {
+			defer imageWG.Done()
+			for job := range imageJobs {
+				job := job
+				panics.run(job.i, "image", func() {
+					if *verifyMetadata {
+						if err := checkMetadata(job.meta, drawnLayers(job.layers)); err != nil {
+							log.Fatal(err)
+						}
+					}
+					job.meta.Image = saveImageToFile(job.i, job.img, outputDir)
+					if *thumbnails > 0 {
+						if err := saveThumbnail(job.i, job.img, outputDir); err != nil {
+							log.Fatal(err)
+						}
+					}
+					if *nameBy == "hash" {
+						hashes.add(job.i, getTokenPath(outputDir, job.i, job.meta.Image))
+					}
+					metaJobs <- metaJob{i: job.i, meta: job.meta, layers: job.layers}
+				})
+			}
+		}()
+	}
+
+	for w := 0; w < metaWorkers; w++ {
+		metaWG.Add(1)
+		go func() {
+			defer metaWG.Done()
+			for job := range metaJobs {
+				job := job
+				panics.run(job.i, "metadata", func() {
+					tokens.add(job.i, job.meta, job.layers)
+
+					// Rarities are only known once every token exists
+					if !*attributeRarity {
+						saveMetadataToFile(job.i, job.meta, outputDir)
+					}
+
+					checksum, err := getImageChecksum(outputDir, job.i, job.meta.Image)
+					if err == nil {
+						token := ManifestToken{Index: job.i, Image: job.meta.Image, Checksum: checksum, Layers: job.layers}
+						if reshuffled[job.i] {
+							token.Nonce = *nonce
+						}
+						err = manifest.add(token)
+					}
+					if err != nil {
+						log.Fatal(err)
+					}
+				})
+			}
+		}()
+	}
+
+	// Tokens of an interrupted run that are kept
+	resumed := map[int][]Layer{}
+	if *resume {
+		resumed, err = resumeTokens(dirs, outputDir, cache, usage, tokens, manifest)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Near saturation unique combinations are drawn directly instead
+	sampler, err := newCombinationSampler(dirs, nftCount)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if sampler == nil && *companionManifest == "" {
+		err := checkFeasibility(dirs, nftCount)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	selector := &tokenSelector{dirs: dirs, sampler: sampler, exists: func(key string) bool {
+		_, ok := cache[key]
+		return ok
+	}}
 
 	// Loop through each NFT and generate a unique image for it
 	for i := 1; i < nftCount+1; i++ {
+		if layers, ok := resumed[i]; ok {
+			selector.previous = layers
+			continue
+		}
 
-		// Read a random set of layers from the specified directories
-		layers, err := readRandomLayersFromDirs(dirs)
+		layers, err := selector.next(i)
 		if err != nil {
-			log.Fatal("Error reading layers from dirs")
+			log.Fatal(err)
 		}
 
-		// Check if the combination of layers already exists in the cache
-		combined, ok := getFromCache(cache, layers)
-		if !ok {
-			// If the combination of layers isn't in the cache, combine the layers to generate a unique image
-			combined = combineLayers(layers)
-			cache[getCacheKey(layers)] = combined
-		} else {
-			// If the combination of layers is in the cache, skip this iteration and move on to the next one
-			fmt.Println(getCacheKey(layers), "already exists")
-			continue
+		// Uniqueness is decided without the bonus, which depends on the index only
+		cacheKey := getCacheKey(layers)
+		layers = addBonusLayer(i, layers)
+
+		err = loadLayers(layers)
+		if err != nil {
+			log.Fatal("Error reading layers from dirs: ", err)
 		}
 
-		// Save the generated image to a file
-		// saveImageToFile(i, combined, outputDir)
-		go func(i int, combined image.Image, outputDir string) {
-			saveImageToFile(i, combined, outputDir)
-			done <- true
-		}(i, combined, outputDir)
+		// Combine the layers to generate a unique image
+		combined := renderToken(i, layers)
+		cache[cacheKey] = combined
+
+		for _, layer := range layers {
+			usage[layer.Path]++
+		}
 
+		// Save the generated image and its metadata to files
+		imageJobs <- imageJob{i: i, img: combined, layers: layers, meta: buildMetadata(i, layers)}
 	}
 
-	// Wait for all goroutines to finish executing
-	for i := 1; i < nftCount+1; i++ {
-		<-done
+	// Wait for all workers to finish writing
+	close(imageJobs)
+	imageWG.Wait()
+	close(metaJobs)
+	metaWG.Wait()
+	panics.close()
+
+	rerolls.report(nftCount)
+
+	if *nameBy == "hash" {
+		hashes.save(outputDir)
+	}
+
+	err = manifest.flush()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = saveRecipe(dirs, outputDir, manifest.reshuffled())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *attributeRarity {
+		addAttributeRarity(tokens)
+		for _, i := range tokens.indexes() {
+			saveMetadataToFile(i, tokens.metas[i], outputDir)
+		}
+	}
+
+	if *export != "" {
+		err := saveExport(*export, tokens, outputDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *traitsJSON {
+		err := saveTraitValues(dirs, nftCount, outputDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *splitTiers {
+		err := splitIntoTiers(tokens, outputDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *revealStart != "" {
+		err := saveRevealSchedule(tokens, outputDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *merkle {
+		err := saveMerkleTree(tokens, outputDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *traitCoverage {
+		err := reportTraitCoverage(dirs, usage)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *requireAllTraitTypes {
+		err := checkAllTraitTypes(dirs, tokens)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
 }
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestChunkedOutput(t *testing.T) {
+	tests := []struct {
+		name      string
+		chunkSize int
+		count     int
+		batches   map[string][]int
+	}{
+		{"unchunked", 0, 3, map[string][]int{".": {1, 2, 3}}},
+		{"uneven last batch", 2, 5, map[string][]int{"batch_0001": {1, 2}, "batch_0002": {3, 4}, "batch_0003": {5}}},
+		{"one token per batch", 1, 3, map[string][]int{"batch_0001": {1}, "batch_0002": {2}, "batch_0003": {3}}},
+		{"single batch", 10, 4, map[string][]int{"batch_0001": {1, 2, 3, 4}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "layers", "1 Background"), "blue.png", "red.png", "green.png")
+			writeLayers(t, filepath.Join(work, "layers", "2 Face"), "smile.png", "frown.png", "wink.png")
+			env := []string{
+				"DIR1=layers/1 Background",
+				"DIR2=layers/2 Face",
+				"NFT_COUNT=" + strconv.Itoa(tt.count),
+				"OUTPUT_DIR=out",
+			}
+			mustRunMixer(t, work, env, "-seed", "7", "-chunk-size", strconv.Itoa(tt.chunkSize))
+
+			out := filepath.Join(work, "out")
+			for batch, indexes := range tt.batches {
+				for _, i := range indexes {
+					for _, ext := range []string{".png", ".json"} {
+						path := filepath.Join(out, batch, strconv.Itoa(i)+ext)
+						if _, err := os.Stat(path); err != nil {
+							t.Errorf("token %d: %v", i, err)
+						}
+					}
+				}
+			}
+
+			// No batch folder beyond the expected ones, and nothing else in them
+			var got []string
+			entries, err := os.ReadDir(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				if entry.IsDir() {
+					got = append(got, entry.Name())
+					files, _ := os.ReadDir(filepath.Join(out, entry.Name()))
+					if want := 2 * len(tt.batches[entry.Name()]); len(files) != want {
+						t.Errorf("%s has %d files, want %d", entry.Name(), len(files), want)
+					}
+				}
+			}
+			var want []string
+			for batch := range tt.batches {
+				if batch != "." {
+					want = append(want, batch)
+				}
+			}
+			sort.Strings(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("batch folders %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestPickExactlyK(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		pick  int
+		// allowed lists the only files that may be drawn, nil for all
+		allowed []string
+	}{
+		{"single trait", []string{"a.png", "b.png", "c.png"}, 1, nil},
+		{"two of five", []string{"a.png", "b.png", "c.png", "d.png", "e.png"}, 2, nil},
+		{"weighted three of five", []string{"a#5.png", "b#1.png", "c#10.png", "d.png", "e#0.5.png"}, 3, nil},
+		{"all of them", []string{"a.png", "b.png", "c.png"}, 3, nil},
+		{"zero weights are never drawn", []string{"a.png", "b#0.png", "c.png", "d#0.png"}, 2, []string{"a.png", "c.png"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "Piercing")
+			writeLayers(t, path, tt.files...)
+			dirs := []LayerDir{{Key: "DIR1", Path: path, Pick: tt.pick}}
+
+			for i := 1; i <= 500; i++ {
+				layers, err := selectRandomLayers(tokenRand(i), dirs)
+				if err != nil {
+					t.Fatal(err)
+				}
+				seen := map[string]bool{}
+				for _, layer := range layers {
+					seen[layer.Name] = true
+					if tt.allowed != nil && !slices.Contains(tt.allowed, layer.Name) {
+						t.Fatalf("token %d drew %s", i, layer.Name)
+					}
+				}
+				if len(layers) != tt.pick || len(seen) != tt.pick {
+					t.Fatalf("token %d drew %d layers (%d distinct), want %d", i, len(layers), len(seen), tt.pick)
+				}
+				if !sort.SliceIsSorted(layers, func(a, b int) bool { return layers[a].Name < layers[b].Name }) {
+					t.Fatalf("token %d members aren't in directory order: %v", i, layers)
+				}
+			}
+		})
+	}
+}
+
+func TestPickMoreThanAvailable(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		pick  int
+	}{
+		{"more than the files", []string{"a.png", "b.png"}, 3},
+		{"more than the weighted files", []string{"a.png", "b#0.png", "c#0.png"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "Piercing")
+			writeLayers(t, path, tt.files...)
+			_, err := selectRandomLayers(tokenRand(1), []LayerDir{{Key: "DIR1", Path: path, Pick: tt.pick}})
+			if err == nil {
+				t.Fatal("selection succeeded")
+			}
+		})
+	}
+}
+
+func TestMinTraits(t *testing.T) {
+	tests := []struct {
+		name      string
+		minTraits int
+		absence   float64
+	}{
+		{"never all absent without min-traits", 0, 0.9},
+		{"at least one", 1, 0.9},
+		{"at least two", 2, 0.8},
+		{"every layer", 4, 0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			var dirs []LayerDir
+			for n, trait := range []string{"Hat", "Glasses", "Scarf", "Badge"} {
+				writeLayers(t, filepath.Join(root, trait), "a.png", "b.png")
+				dirs = append(dirs, LayerDir{Key: "DIR" + strconv.Itoa(n+1), Path: filepath.Join(root, trait), Pick: 1, Absence: tt.absence})
+			}
+			setFlag(t, "seed", "3")
+			setFlag(t, "min-traits", strconv.Itoa(tt.minTraits))
+
+			for i := 1; i <= 300; i++ {
+				layers, err := selectToken(i, tokenRand(i), dirs, rerolls)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n := countPresent(layers); n < max(tt.minTraits, 1) {
+					t.Fatalf("token %d has %d present traits", i, n)
+				}
+			}
+		})
+	}
+}
+
+func TestAllOptionalCollection(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"re-rolling", []string{"-enumerate-above", "0"}},
+		{"sampling", []string{"-enumerate-above", "0.01"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			env := []string{"NFT_COUNT=20", "OUTPUT_DIR=out"}
+			for n, trait := range []string{"1 Hat", "2 Glasses", "3 Scarf"} {
+				writeLayers(t, filepath.Join(work, trait), "a.png", "b.png", "c.png")
+				key := "DIR" + strconv.Itoa(n+1)
+				env = append(env, key+"="+trait, key+"_ABSENCE=0.5")
+			}
+			mustRunMixer(t, work, env, append([]string{"-seed", "9"}, tt.args...)...)
+
+			for i := 1; i <= 20; i++ {
+				var meta Metadata
+				readJSON(t, filepath.Join(work, "out", strconv.Itoa(i)+".json"), &meta)
+				present := 0
+				for _, attr := range meta.Attributes {
+					if attr.Value != noneTrait {
+						present++
+					}
+				}
+				if present == 0 {
+					t.Errorf("token %d has no present trait", i)
+				}
+			}
+		})
+	}
+}
+
+// TestWorkerPools is meant to run under go test -race: the child process
+// is the same instrumented binary and exits with an error on a data race.
+func TestWorkerPools(t *testing.T) {
+	tests := []struct {
+		name                string
+		imageWorkers, metas int
+	}{
+		{"one of each", 1, 1},
+		{"more image workers", 6, 1},
+		{"more metadata workers", 1, 5},
+		{"many of both", 8, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			for _, trait := range []string{"1 Background", "2 Body", "3 Eyes"} {
+				writeLayers(t, filepath.Join(work, trait), "a.png", "b.png", "c.png", "d.png")
+			}
+			env := []string{
+				"DIR1=1 Background", "DIR2=2 Body", "DIR3=3 Eyes",
+				"NFT_COUNT=30", "OUTPUT_DIR=out",
+				"IMAGE_WORKERS=" + strconv.Itoa(tt.imageWorkers),
+				"META_WORKERS=" + strconv.Itoa(tt.metas),
+			}
+			mustRunMixer(t, work, env, "-seed", "21")
+
+			for i := 1; i <= 30; i++ {
+				readPNG(t, filepath.Join(work, "out", strconv.Itoa(i)+".png"))
+				var meta Metadata
+				readJSON(t, filepath.Join(work, "out", strconv.Itoa(i)+".json"), &meta)
+				if meta.Image != strconv.Itoa(i)+".png" || len(meta.Attributes) != 3 {
+					t.Errorf("token %d has metadata %+v", i, meta)
+				}
+			}
+			var manifest Manifest
+			readJSON(t, filepath.Join(work, "out", "manifest.json"), &manifest)
+			if len(manifest.Tokens) != 30 {
+				t.Errorf("manifest lists %d tokens, want 30", len(manifest.Tokens))
+			}
+		})
+	}
+}
+
+func TestNFTCount(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+		err   string
+	}{
+		{"1", 1, ""},
+		{"250", 250, ""},
+		{"", 0, "NFT_COUNT environment variable not set"},
+		{"0", 0, "NFT_COUNT must be at least 1, got 0"},
+		{"-3", 0, "NFT_COUNT must be at least 1, got -3"},
+		{"ten", 0, "NFT_COUNT must be a whole number, got 'ten'"},
+		{"2.5", 0, "NFT_COUNT must be a whole number, got '2.5'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("NFT_COUNT", tt.value)
+			got, err := getNFTCount()
+			if tt.err == "" {
+				if err != nil || got != tt.want {
+					t.Errorf("got %d, %v, want %d", got, err, tt.want)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestInvalidNFTCountCreatesNothing(t *testing.T) {
+	for _, value := range []string{"0", "-1", "many"} {
+		t.Run(value, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "a.png")
+			out, err := runMixer(t, work, []string{"DIR1=1 Background", "NFT_COUNT=" + value, "OUTPUT_DIR=out"})
+			if err == nil {
+				t.Fatalf("NFT_COUNT=%s succeeded:\n%s", value, out)
+			}
+			if _, err := os.Stat(filepath.Join(work, "out")); !os.IsNotExist(err) {
+				t.Errorf("NFT_COUNT=%s created the output directory", value)
+			}
+		})
+	}
+}
+
+func TestQualifiedCacheKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []Layer
+	}{
+		{"same file in swapped directories",
+			[]Layer{{Trait: "Background", Name: "red.png"}, {Trait: "Hat", Name: "blue.png"}},
+			[]Layer{{Trait: "Background", Name: "blue.png"}, {Trait: "Hat", Name: "red.png"}}},
+		{"same file in one directory or the other",
+			[]Layer{{Trait: "Background", Name: "red.png"}},
+			[]Layer{{Trait: "Hat", Name: "red.png"}}},
+		{"separator in a name",
+			[]Layer{{Trait: "Hat", Name: "a.png,\"Hat\":b.png"}},
+			[]Layer{{Trait: "Hat", Name: "a.png"}, {Trait: "Hat", Name: "b.png"}}},
+		{"separator in a trait",
+			[]Layer{{Trait: "Hat:red.png", Name: "x.png"}},
+			[]Layer{{Trait: "Hat", Name: "red.png:x.png"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if a, b := getCacheKey(tt.a), getCacheKey(tt.b); a == b {
+				t.Errorf("both combinations have the key %s", a)
+			}
+		})
+	}
+}
+
+func TestSameNamedFiles(t *testing.T) {
+	work := t.TempDir()
+	writeLayers(t, filepath.Join(work, "1 Background"), "blue.png", "red.png")
+	writeLayers(t, filepath.Join(work, "2 Hat"), "red.png", "blue.png")
+	env := []string{"DIR1=1 Background", "DIR2=2 Hat", "NFT_COUNT=4", "OUTPUT_DIR=out"}
+	mustRunMixer(t, work, env, "-seed", "1", "-enumerate-above", "1")
+
+	// All four combinations are drawn once, told apart by their trait_type
+	seen := map[string]bool{}
+	for i := 1; i <= 4; i++ {
+		var meta Metadata
+		readJSON(t, filepath.Join(work, "out", strconv.Itoa(i)+".json"), &meta)
+		if len(meta.Attributes) != 2 || meta.Attributes[0].TraitType != "Background" || meta.Attributes[1].TraitType != "Hat" {
+			t.Fatalf("token %d has attributes %+v", i, meta.Attributes)
+		}
+		seen[meta.Attributes[0].Value+"/"+meta.Attributes[1].Value] = true
+	}
+	if len(seen) != 4 {
+		t.Errorf("drew %v, want every combination once", seen)
+	}
+}
+
+func TestReproducibleOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		env  []string
+		args []string
+	}{
+		{"plain", nil, nil},
+		{"weights, absence and picks", []string{"DIR2_ABSENCE=0.4", "DIR3_PICK=2"}, nil},
+		{"chunked with tiers", nil, []string{"-chunk-size", "4", "-split-tiers"}},
+		{"sampled combinations", []string{"DIR2_ABSENCE=0.3"}, []string{"-enumerate-above", "0.01"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run := func(reversed bool) map[string][]byte {
+				work := t.TempDir()
+				writeLayers(t, filepath.Join(work, "1 Background"), "amber.png", "blue#2.png", "coral.png", "dune#0.5.png")
+				writeLayers(t, filepath.Join(work, "2 Eyes"), "closed.png", "open#3.png", "wink.png")
+				writeLayers(t, filepath.Join(work, "3 Badge"), "a.png", "b#2.png", "c.png", "d.png")
+				env := append([]string{"DIR1=1 Background", "DIR2=2 Eyes", "DIR3=3 Badge", "NFT_COUNT=10", "OUTPUT_DIR=out"}, tt.env...)
+				if reversed {
+					env = append(env, reverseReadDirEnv+"=1")
+				}
+				mustRunMixer(t, work, env, append([]string{"-seed", "77"}, tt.args...)...)
+				return mustReadTree(t, filepath.Join(work, "out"))
+			}
+
+			first := run(false)
+			if len(first) == 0 {
+				t.Fatal("nothing was written")
+			}
+			t.Run("again", func(t *testing.T) { diffTrees(t, run(false), first) })
+			t.Run("reversed ReadDir", func(t *testing.T) { diffTrees(t, run(true), first) })
+		})
+	}
+}
+
+func TestLayersLimit(t *testing.T) {
+	background := color.NRGBA{10, 60, 200, 255}
+	body := color.NRGBA{240, 200, 20, 255}
+	hat := color.NRGBA{200, 20, 20, 255}
+
+	tests := []struct {
+		name   string
+		limit  int
+		noBody bool
+		// want is the color of the body (left) and hat (right) pixel
+		want [2]color.NRGBA
+	}{
+		{"no limit", 0, false, [2]color.NRGBA{body, hat}},
+		{"background only", 1, false, [2]color.NRGBA{background, background}},
+		{"background and body", 2, false, [2]color.NRGBA{body, background}},
+		{"limit above the layers", 5, false, [2]color.NRGBA{body, hat}},
+		{"absent layers don't count", 2, true, [2]color.NRGBA{background, hat}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			half := func(x0 int, c color.NRGBA) *image.NRGBA {
+				img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+				for y := 0; y < 4; y++ {
+					img.SetNRGBA(x0, y, c)
+					img.SetNRGBA(x0+1, y, c)
+				}
+				return img
+			}
+			writePNG(t, filepath.Join(root, "background.png"), solid(4, 4, background))
+			writePNG(t, filepath.Join(root, "body.png"), half(0, body))
+			writePNG(t, filepath.Join(root, "hat.png"), half(2, hat))
+			layers := []Layer{
+				{Name: "background.png", Trait: "Background", Path: filepath.Join(root, "background.png")},
+				{Name: "body.png", Trait: "Body", Path: filepath.Join(root, "body.png")},
+				{Name: "hat.png", Trait: "Hat", Path: filepath.Join(root, "hat.png")},
+			}
+			if tt.noBody {
+				layers[1] = Layer{Name: noneTrait, Trait: "Body"}
+			}
+			if err := loadLayers(layers); err != nil {
+				t.Fatal(err)
+			}
+			setFlag(t, "layers-limit", strconv.Itoa(tt.limit))
+
+			img := combineLayers(layers)
+			for n, x := range []int{0, 3} {
+				if got := color.NRGBAModel.Convert(img.At(x, 1)); got != tt.want[n] {
+					t.Errorf("pixel %d,1 is %v, want %v", x, got, tt.want[n])
+				}
+			}
+		})
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		// err is empty when the run is accepted
+		err string
+	}{
+		{"flat output", []string{"-max-depth", "1"}, ""},
+		{"chunks fit", []string{"-max-depth", "2", "-chunk-size", "2"}, ""},
+		{"every option fits", []string{"-max-depth", "2", "-chunk-size", "2", "-split-tiers", "50", "-thumbnails", "2"}, ""},
+		{"chunks too deep", []string{"-max-depth", "1", "-chunk-size", "2"}, "the output options write files 2 levels below OUTPUT_DIR, more than -max-depth 1"},
+		{"tiers too deep", []string{"-max-depth", "1", "-split-tiers", "50"}, "more than -max-depth 1"},
+		{"thumbnails too deep", []string{"-max-depth", "1", "-thumbnails", "2"}, "more than -max-depth 1"},
+		{"negative", []string{"-max-depth", "-1"}, "Invalid -max-depth value -1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "a.png", "b.png", "c.png", "d.png")
+			out, err := runMixer(t, work, []string{"DIR1=1 Background", "NFT_COUNT=4", "OUTPUT_DIR=out"}, tt.args...)
+			outputDir := filepath.Join(work, "out")
+
+			if tt.err != "" {
+				if err == nil {
+					t.Fatalf("run succeeded:\n%s", out)
+				}
+				if !strings.Contains(out, tt.err) {
+					t.Errorf("output doesn't say %q:\n%s", tt.err, out)
+				}
+				// Rejected before anything is generated
+				if _, err := os.Stat(outputDir); !os.IsNotExist(err) {
+					t.Error("the output directory was created")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("%v\n%s", err, out)
+			}
+
+			maxDepth, _ := strconv.Atoi(tt.args[1])
+			for name := range mustReadTree(t, outputDir) {
+				if depth := len(strings.Split(name, "/")); depth > maxDepth {
+					t.Errorf("%s is %d levels deep", name, depth)
+				}
+			}
+		})
+	}
+}
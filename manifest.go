@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+var rerenderAffected = flag.String("rerender-affected", "", "re-render only the tokens of OUTPUT_DIR whose manifest uses the given layer file")
+
+// ManifestToken records exactly what went into a token's image, so it can
+// be rendered again without repeating the selection.
+type ManifestToken struct {
+	Index int    `json:"index"`
+	Image string `json:"image"`
+	// Checksum is the sha256 of the image file, see -resume.
+	Checksum string `json:"checksum,omitempty"`
+	// Nonce is the -nonce the token was last reshuffled with.
+	Nonce  int     `json:"nonce,omitempty"`
+	Layers []Layer `json:"layers"`
+}
+
+// Manifest is written to manifest.json while a run writes its tokens.
+type Manifest struct {
+	Seed   int64           `json:"seed"`
+	Tokens []ManifestToken `json:"tokens"`
+}
+
+// manifestInterval is how often at most manifest.json is rewritten while
+// tokens finish.
+var manifestInterval = time.Second
+
+// manifestWriter keeps manifest.json up to date with the finished tokens,
+// so an interrupted run can be resumed from every token it wrote.
+type manifestWriter struct {
+	mu        sync.Mutex
+	outputDir string
+	tokens    map[int]ManifestToken
+	written   time.Time
+}
+
+func newManifestWriter(outputDir string) *manifestWriter {
+	return &manifestWriter{outputDir: outputDir, tokens: map[int]ManifestToken{}}
+}
+
+// add records a token whose files are written, rewriting manifest.json if
+// the last write is manifestInterval ago.
+func (w *manifestWriter) add(token ManifestToken) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.tokens[token.Index] = token
+	if time.Since(w.written) < manifestInterval {
+		return nil
+	}
+	return w.write()
+}
+
+// flush writes manifest.json with every token added so far.
+func (w *manifestWriter) flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.write()
+}
+
+// reshuffled returns the indexes of the added tokens that were reshuffled,
+// in this run or an earlier one.
+func (w *manifestWriter) reshuffled() []int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var indexes []int
+	for i, token := range w.tokens {
+		if token.Nonce > 0 {
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+func (w *manifestWriter) write() error {
+	manifest := Manifest{Seed: *seed, Tokens: make([]ManifestToken, 0, len(w.tokens))}
+	for _, token := range w.tokens {
+		manifest.Tokens = append(manifest.Tokens, token)
+	}
+	sort.Slice(manifest.Tokens, func(a, b int) bool {
+		return manifest.Tokens[a].Index < manifest.Tokens[b].Index
+	})
+	w.written = time.Now()
+	return writeManifest(manifest, w.outputDir)
+}
+
+// writeManifest replaces manifest.json in outputDir. It's written to a
+// temporary file first and renamed over the old one, so an interrupted
+// write can't leave a truncated manifest behind.
+func writeManifest(manifest Manifest, outputDir string) error {
+	// Slash separated paths keep the manifest the same on every OS
+	tokens := make([]ManifestToken, len(manifest.Tokens))
+	for t, token := range manifest.Tokens {
+		layers := make([]Layer, len(token.Layers))
+		for l, layer := range token.Layers {
+			layer.Path = filepath.ToSlash(layer.Path)
+			layers[l] = layer
+		}
+		token.Layers = layers
+		tokens[t] = token
+	}
+	manifest.Tokens = tokens
+
+	data, err := encodeJSON(manifest)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(outputDir, "manifest.json")
+	err = os.WriteFile(path+".tmp", data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// getImageChecksum returns the sha256 of the image file of token i.
+func getImageChecksum(outputDir string, i int, fileName string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(outputDir, getTokenPath(outputDir, i, fileName)))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// getManifestSeed returns the seed recorded in the manifest of outputDir.
+func getManifestSeed(outputDir string) (int64, error) {
+	manifest, err := readManifest(outputDir)
+	if err != nil {
+		return 0, fmt.Errorf("-resume and -rerender-affected need the manifest.json of an earlier run: %v", err)
+	}
+	return manifest.Seed, nil
+}
+
+func readManifest(outputDir string) (Manifest, error) {
+	return readManifestFile(filepath.Join(outputDir, "manifest.json"))
+}
+
+func readManifestFile(path string) (Manifest, error) {
+	var manifest Manifest
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return manifest, err
+	}
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		return manifest, err
+	}
+
+	for _, token := range manifest.Tokens {
+		for l := range token.Layers {
+			token.Layers[l].Path = filepath.FromSlash(token.Layers[l].Path)
+			token.Layers[l] = resolveLayerAlias(token.Layers[l])
+		}
+	}
+	return manifest, nil
+}
+
+// renderManifestToken composites a token from its manifest entry. The
+// grayscale handling and preprocessing aren't per token, so they come from
+// the current configuration of the layer's directory.
+func renderManifestToken(token ManifestToken, dirs []LayerDir) error {
+	for l, layer := range token.Layers {
+		for _, dir := range dirs {
+			groups, err := getLayerGroups(dir)
+			if err != nil {
+				return err
+			}
+			for _, group := range groups {
+				if filepath.Dir(layer.Path) == filepath.Clean(group.Path) {
+					token.Layers[l].Gray = dir.Gray
+					token.Layers[l].Preprocess = dir.Preprocess
+				}
+			}
+		}
+	}
+	return loadLayers(token.Layers)
+}
+
+// rerenderAffectedTokens renders again every token whose layers include
+// asset and leaves all other files untouched, apart from the checksums of
+// the re-rendered images in manifest.json. Output options such as -mask
+// and OUTPUT_FORMAT must match the original run.
+func rerenderAffectedTokens(asset string, dirs []LayerDir, outputDir string) error {
+	if *nameBy == "hash" {
+		return errors.New("-rerender-affected needs -name-by index, re-rendered hash named images would change their names")
+	}
+
+	manifest, err := readManifest(outputDir)
+	if err != nil {
+		return err
+	}
+
+	rendered := 0
+	for n, token := range manifest.Tokens {
+		affected := false
+		for _, layer := range token.Layers {
+			if layer.Path != "" && filepath.Clean(layer.Path) == filepath.Clean(asset) {
+				affected = true
+			}
+		}
+		if !affected {
+			continue
+		}
+
+		err := renderManifestToken(token, dirs)
+		if err != nil {
+			return err
+		}
+		saveImageToFile(token.Index, renderToken(token.Index, token.Layers), outputDir)
+		rendered++
+
+		// A later -resume compares the images against these
+		manifest.Tokens[n].Checksum, err = getImageChecksum(outputDir, token.Index, token.Image)
+		if err != nil {
+			return err
+		}
+	}
+	if rendered > 0 {
+		err := writeManifest(manifest, outputDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Re-rendered %d of %d tokens using '%s'\n", rendered, len(manifest.Tokens), asset)
+	return nil
+}
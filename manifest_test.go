@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRerenderAffected(t *testing.T) {
+	tests := []struct {
+		name  string
+		asset string
+		args  []string
+	}{
+		{"background file", filepath.Join("1 Background", "red.png"), nil},
+		{"top layer file", filepath.Join("2 Hat", "crown.png"), nil},
+		{"masked output", filepath.Join("1 Background", "blue.png"), []string{"-mask", "circle"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "red.png", "blue.png", "green.png")
+			writeLayers(t, filepath.Join(work, "2 Hat"), "cap.png", "crown.png", "fez.png")
+			env := []string{"DIR1=1 Background", "DIR2=2 Hat", "NFT_COUNT=6", "OUTPUT_DIR=out"}
+			mustRunMixer(t, work, env, append([]string{"-seed", "12"}, tt.args...)...)
+			out := filepath.Join(work, "out")
+
+			var manifest Manifest
+			readJSON(t, filepath.Join(out, "manifest.json"), &manifest)
+			affected := map[int]bool{}
+			before := map[int][]byte{}
+			for _, token := range manifest.Tokens {
+				for _, layer := range token.Layers {
+					if filepath.FromSlash(layer.Path) == tt.asset {
+						affected[token.Index] = true
+					}
+				}
+				before[token.Index], _ = os.ReadFile(filepath.Join(out, token.Image))
+			}
+			if len(affected) == 0 || len(affected) == len(manifest.Tokens) {
+				t.Fatalf("%d of %d tokens use %s, the fixture can't tell them apart", len(affected), len(manifest.Tokens), tt.asset)
+			}
+
+			// Edit the asset, then re-render only its tokens
+			writePNG(t, filepath.Join(work, tt.asset), solid(4, 4, color.NRGBA{10, 250, 10, 200}))
+			got := mustRunMixer(t, work, env, append([]string{"-rerender-affected", tt.asset}, tt.args...)...)
+			if want := "Re-rendered " + strconv.Itoa(len(affected)) + " of 6 tokens"; !strings.Contains(got, want) {
+				t.Errorf("output doesn't say %q:\n%s", want, got)
+			}
+
+			var updated Manifest
+			readJSON(t, filepath.Join(out, "manifest.json"), &updated)
+			for n, token := range updated.Tokens {
+				after, _ := os.ReadFile(filepath.Join(out, token.Image))
+				if changed := !bytes.Equal(before[token.Index], after); changed != affected[token.Index] {
+					t.Errorf("token %d: uses the asset %v, image changed %v", token.Index, affected[token.Index], changed)
+				}
+				checksum, _ := getImageChecksum(out, token.Index, token.Image)
+				if token.Checksum != checksum {
+					t.Errorf("token %d: manifest checksum isn't the one of its image", token.Index)
+				}
+				if !affected[token.Index] && token.Checksum != manifest.Tokens[n].Checksum {
+					t.Errorf("token %d: unaffected checksum changed", token.Index)
+				}
+			}
+
+			// With the checksums updated, resuming keeps every token
+			got = mustRunMixer(t, work, env, append([]string{"-resume"}, tt.args...)...)
+			if !strings.Contains(got, "Resumed 6 tokens, 0 of them re-rendered") {
+				t.Errorf("resume re-rendered tokens:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestManifestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, work string) []string
+		// changed tells whether a line of the manifest may differ, nil when
+		// the manifests must be identical
+		changed func(line string) bool
+		// lines is how many lines differ, -1 for one per token using fez.png
+		lines int
+	}{
+		{"same seed", func(t *testing.T, work string) []string { return nil }, nil, 0},
+		{"one file redrawn", func(t *testing.T, work string) []string {
+			writePNG(t, filepath.Join(work, "2 Hat", "fez.png"), solid(4, 4, color.NRGBA{9, 99, 199, 200}))
+			return nil
+		}, func(line string) bool { return strings.HasPrefix(strings.TrimSpace(line), `"checksum": `) }, -1},
+		{"one trait_type renamed", func(t *testing.T, work string) []string {
+			return []string{"DIR2_TRAIT=Headwear"}
+		}, func(line string) bool { return strings.TrimSpace(line) == `"trait_type": "Headwear",` }, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "red.png", "blue.png", "green.png")
+			writeLayers(t, filepath.Join(work, "2 Hat"), "cap.png", "crown.png", "fez.png")
+			env := []string{"DIR1=1 Background", "DIR2=2 Hat", "NFT_COUNT=6", "OUTPUT_DIR=out"}
+			manifestPath := filepath.Join(work, "out", "manifest.json")
+
+			mustRunMixer(t, work, env, "-seed", "12")
+			before, err := os.ReadFile(manifestPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var manifest Manifest
+			readJSON(t, manifestPath, &manifest)
+			usingFez := 0
+			for _, token := range manifest.Tokens {
+				for _, layer := range token.Layers {
+					if layer.Name == "fez.png" {
+						usingFez++
+					}
+				}
+			}
+
+			extra := tt.change(t, work)
+			if err := os.RemoveAll(filepath.Join(work, "out")); err != nil {
+				t.Fatal(err)
+			}
+			mustRunMixer(t, work, append(env, extra...), "-seed", "12")
+			after, err := os.ReadFile(manifestPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.changed == nil {
+				if !bytes.Equal(after, before) {
+					t.Fatal("the manifests of two runs differ")
+				}
+				return
+			}
+
+			// The layout stays put, so the diff is the changed lines alone
+			oldLines, newLines := strings.Split(string(before), "\n"), strings.Split(string(after), "\n")
+			if len(oldLines) != len(newLines) {
+				t.Fatalf("the manifest went from %d to %d lines", len(oldLines), len(newLines))
+			}
+			differ := 0
+			for n := range newLines {
+				if oldLines[n] == newLines[n] {
+					continue
+				}
+				differ++
+				if !tt.changed(newLines[n]) {
+					t.Errorf("line %d changed from %q to %q", n+1, oldLines[n], newLines[n])
+				}
+			}
+			want := tt.lines
+			if want < 0 {
+				want = usingFez
+			}
+			if differ != want || want == 0 {
+				t.Errorf("%d lines changed, want %d", differ, want)
+			}
+		})
+	}
+}
+
+func TestManifestWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		// tokens in manifest.json after each add
+		written []int
+	}{
+		{"every token", 0, []int{1, 2, 3}},
+		{"throttled", time.Hour, []int{1, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := manifestInterval
+			manifestInterval = tt.interval
+			t.Cleanup(func() { manifestInterval = old })
+
+			dir := t.TempDir()
+			writer := newManifestWriter(dir)
+			read := func() []ManifestToken {
+				var manifest Manifest
+				readJSON(t, filepath.Join(dir, "manifest.json"), &manifest)
+				return manifest.Tokens
+			}
+			// Tokens finish out of order, the manifest lists them by index
+			for n, i := range []int{3, 1, 2} {
+				err := writer.add(ManifestToken{Index: i, Image: "x.png", Layers: []Layer{{Path: filepath.Join("1 Body", "round.png")}}})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := len(read()); got != tt.written[n] {
+					t.Errorf("after %d tokens the manifest has %d, want %d", n+1, got, tt.written[n])
+				}
+			}
+
+			if err := writer.flush(); err != nil {
+				t.Fatal(err)
+			}
+			tokens := read()
+			for n, token := range tokens {
+				if token.Index != n+1 {
+					t.Errorf("token %d is at position %d", token.Index, n)
+				}
+				if token.Layers[0].Path != "1 Body/round.png" {
+					t.Errorf("token %d layer path isn't slash separated: %q", token.Index, token.Layers[0].Path)
+				}
+			}
+			if len(tokens) != 3 {
+				t.Errorf("flushed manifest has %d tokens, want 3", len(tokens))
+			}
+			if _, err := os.Stat(filepath.Join(dir, "manifest.json.tmp")); !os.IsNotExist(err) {
+				t.Errorf("temporary manifest left behind: %v", err)
+			}
+		})
+	}
+}
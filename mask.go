@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"image"
+	"image/draw"
+	"log"
+	"math"
+)
+
+var mask = flag.String("mask", "", "crop the composite to a 'circle' or 'rounded' rectangle with anti-aliased edges")
+var cornerRadius = flag.Int("corner-radius", 64, "corner radius in pixels of -mask rounded")
+
+// maskSamples is the supersampling grid size per axis used to compute how
+// much of a boundary pixel lies inside the mask.
+const maskSamples = 4
+
+// applyMask crops img to the configured -mask shape. Pixels on the edge get
+// an alpha proportional to how much of them the shape covers.
+func applyMask(img image.Image) image.Image {
+	if *mask == "" {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+
+	var inside func(x, y float64) bool
+	switch *mask {
+	case "circle":
+		r := math.Min(w, h) / 2
+		inside = func(x, y float64) bool {
+			dx, dy := x-w/2, y-h/2
+			return dx*dx+dy*dy <= r*r
+		}
+	case "rounded":
+		r := math.Min(float64(*cornerRadius), math.Min(w, h)/2)
+		inside = func(x, y float64) bool {
+			// Distance from the nearest corner circle center, if in a corner
+			cx := math.Max(r-x, math.Max(0, x-(w-r)))
+			cy := math.Max(r-y, math.Max(0, y-(h-r)))
+			if cx <= 0 || cy <= 0 {
+				return true
+			}
+			return cx*cx+cy*cy <= r*r
+		}
+	default:
+		log.Fatalf("Invalid -mask value '%s'", *mask)
+	}
+
+	masked := image.NewRGBA(bounds)
+	draw.Draw(masked, bounds, img, bounds.Min, draw.Src)
+
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			covered := 0
+			for sy := 0; sy < maskSamples; sy++ {
+				for sx := 0; sx < maskSamples; sx++ {
+					px := float64(x) + (float64(sx)+0.5)/maskSamples
+					py := float64(y) + (float64(sy)+0.5)/maskSamples
+					if inside(px, py) {
+						covered++
+					}
+				}
+			}
+			if covered == maskSamples*maskSamples {
+				continue
+			}
+
+			// Premultiplied colors scale together with alpha
+			coverage := float64(covered) / (maskSamples * maskSamples)
+			i := masked.PixOffset(bounds.Min.X+x, bounds.Min.Y+y)
+			for c := 0; c < 4; c++ {
+				masked.Pix[i+c] = uint8(math.Round(float64(masked.Pix[i+c]) * coverage))
+			}
+		}
+	}
+
+	return masked
+}
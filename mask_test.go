@@ -0,0 +1,81 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestMaskAntialiasing(t *testing.T) {
+	tests := []struct {
+		name          string
+		mask          string
+		radius        int
+		width, height int
+		// edge returns how far a pixel center is outside the shape, so
+		// intermediate alphas must be within a pixel of 0
+		edge func(x, y float64) float64
+	}{
+		{"circle", "circle", 0, 64, 64, func(x, y float64) float64 {
+			return math.Hypot(x-32, y-32) - 32
+		}},
+		{"circle in a wide image", "circle", 0, 64, 32, func(x, y float64) float64 {
+			return math.Hypot(x-32, y-16) - 16
+		}},
+		{"rounded", "rounded", 16, 64, 64, roundedEdge(64, 64, 16)},
+		{"rounded with a radius past half", "rounded", 100, 40, 40, roundedEdge(40, 40, 20)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, "mask", tt.mask)
+			setFlag(t, "corner-radius", strconv.Itoa(tt.radius))
+			img := applyMask(solid(tt.width, tt.height, color.White))
+
+			partial := 0
+			for y := 0; y < tt.height; y++ {
+				for x := 0; x < tt.width; x++ {
+					_, _, _, a := img.At(x, y).RGBA()
+					a >>= 8
+					d := tt.edge(float64(x)+0.5, float64(y)+0.5)
+					switch {
+					case a > 0 && a < 255:
+						partial++
+						if math.Abs(d) > 1 {
+							t.Errorf("pixel %d,%d has alpha %d %.2f pixels from the edge", x, y, a, d)
+						}
+					case d < -1 && a != 255:
+						t.Errorf("pixel %d,%d inside the shape has alpha %d", x, y, a)
+					case d > 1 && a != 0:
+						t.Errorf("pixel %d,%d outside the shape has alpha %d", x, y, a)
+					}
+				}
+			}
+			if partial == 0 {
+				t.Error("the boundary has only alphas 0 and 255")
+			}
+		})
+	}
+}
+
+// roundedEdge returns the signed distance to a w x h rectangle with
+// corners of radius r.
+func roundedEdge(w, h, r float64) func(x, y float64) float64 {
+	return func(x, y float64) float64 {
+		cx := math.Max(r-x, x-(w-r))
+		cy := math.Max(r-y, y-(h-r))
+		if cx <= 0 || cy <= 0 {
+			return math.Max(math.Max(-x, x-w), math.Max(-y, y-h))
+		}
+		return math.Hypot(cx, cy) - r
+	}
+}
+
+func TestNoMask(t *testing.T) {
+	setFlag(t, "mask", "")
+	img := solid(8, 8, color.White)
+	if got := applyMask(img); got != image.Image(img) {
+		t.Error("the image was copied without a mask")
+	}
+}
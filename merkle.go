@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"os"
+	"path/filepath"
+)
+
+var merkle = flag.Bool("merkle", false, "write merkle.json with the Merkle root of all token metadata hashes and a proof per token")
+
+// hashPair hashes two nodes in sorted order, so a proof is just the list of
+// sibling hashes and verifying needs no left/right flags.
+func hashPair(a, b []byte) []byte {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+	sum := sha256.Sum256(append(append([]byte{}, a...), b...))
+	return sum[:]
+}
+
+// buildMerkle builds a Merkle tree over the leaf hashes and returns its root
+// and, for every leaf, the sibling hashes from the leaf up to the root. A
+// node without a sibling is promoted to the next level unchanged.
+func buildMerkle(hashes [][]byte) (root []byte, proofs [][][]byte) {
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	proofs = make([][][]byte, len(hashes))
+	// position of every leaf in the current level
+	positions := make([]int, len(hashes))
+	for i := range positions {
+		positions[i] = i
+	}
+
+	level := hashes
+	for len(level) > 1 {
+		for leaf, pos := range positions {
+			sibling := pos ^ 1
+			if sibling < len(level) {
+				proofs[leaf] = append(proofs[leaf], level[sibling])
+			}
+			positions[leaf] = pos / 2
+		}
+
+		next := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				next = append(next, hashPair(level[i], level[i+1]))
+			} else {
+				next = append(next, level[i])
+			}
+		}
+		level = next
+	}
+
+	return level[0], proofs
+}
+
+type MerkleToken struct {
+	Index int      `json:"index"`
+	Leaf  string   `json:"leaf"`
+	Proof []string `json:"proof"`
+}
+
+type MerkleTree struct {
+	Root   string        `json:"root"`
+	Tokens []MerkleToken `json:"tokens"`
+}
+
+// saveMerkleTree writes merkle.json for the stored tokens. Each leaf is the
+// sha256 of the token's metadata file.
+func saveMerkleTree(tokens *tokenStore, outputDir string) error {
+	indexes := tokens.indexes()
+
+	leaves := make([][]byte, len(indexes))
+	for n, i := range indexes {
+		data, err := encodeMetadata(tokens.metas[i])
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		leaves[n] = sum[:]
+	}
+
+	root, proofs := buildMerkle(leaves)
+
+	tree := MerkleTree{Root: hex.EncodeToString(root), Tokens: []MerkleToken{}}
+	for n, i := range indexes {
+		token := MerkleToken{Index: i, Leaf: hex.EncodeToString(leaves[n]), Proof: []string{}}
+		for _, sibling := range proofs[n] {
+			token.Proof = append(token.Proof, hex.EncodeToString(sibling))
+		}
+		tree.Tokens = append(tree.Tokens, token)
+	}
+
+	data, err := encodeJSON(tree)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outputDir, "merkle.json"), data, 0644)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// verifyProof folds the proof into leaf the way buildMerkle pairs nodes.
+func verifyProof(leaf []byte, proof [][]byte, root []byte) bool {
+	node := leaf
+	for _, sibling := range proof {
+		node = hashPair(node, sibling)
+	}
+	return bytes.Equal(node, root)
+}
+
+func TestMerkleProofs(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 5, 8, 13} {
+		t.Run(strconv.Itoa(n)+" leaves", func(t *testing.T) {
+			leaves := make([][]byte, n)
+			for i := range leaves {
+				sum := sha256.Sum256([]byte("token " + strconv.Itoa(i)))
+				leaves[i] = sum[:]
+			}
+			root, proofs := buildMerkle(leaves)
+			for i, leaf := range leaves {
+				if !verifyProof(leaf, proofs[i], root) {
+					t.Errorf("proof of leaf %d doesn't validate", i)
+				}
+			}
+
+			// Tampering with one leaf breaks its proof and the root
+			for i := range leaves {
+				tampered := append([]byte{}, leaves[i]...)
+				tampered[0] ^= 1
+				if verifyProof(tampered, proofs[i], root) {
+					t.Errorf("tampered leaf %d still validates", i)
+				}
+
+				changed := append([][]byte{}, leaves...)
+				changed[i] = tampered
+				if newRoot, _ := buildMerkle(changed); bytes.Equal(newRoot, root) {
+					t.Errorf("tampering with leaf %d keeps the root", i)
+				}
+			}
+		})
+	}
+}
+
+func TestMerkleFile(t *testing.T) {
+	work := t.TempDir()
+	writeLayers(t, filepath.Join(work, "1 Background"), "red.png", "blue.png", "green.png")
+	writeLayers(t, filepath.Join(work, "2 Hat"), "cap.png", "crown.png")
+	env := []string{"DIR1=1 Background", "DIR2=2 Hat", "NFT_COUNT=5", "OUTPUT_DIR=out"}
+	mustRunMixer(t, work, env, "-seed", "6", "-merkle")
+
+	var tree MerkleTree
+	readJSON(t, filepath.Join(work, "out", "merkle.json"), &tree)
+	root, _ := hex.DecodeString(tree.Root)
+	if len(tree.Tokens) != 5 {
+		t.Fatalf("merkle.json has %d tokens", len(tree.Tokens))
+	}
+	for _, token := range tree.Tokens {
+		metadata, err := os.ReadFile(filepath.Join(work, "out", strconv.Itoa(token.Index)+".json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(metadata)
+		if hex.EncodeToString(sum[:]) != token.Leaf {
+			t.Errorf("leaf of %d isn't the hash of its metadata file", token.Index)
+		}
+
+		var proof [][]byte
+		for _, sibling := range token.Proof {
+			b, _ := hex.DecodeString(sibling)
+			proof = append(proof, b)
+		}
+		if !verifyProof(sum[:], proof, root) {
+			t.Errorf("proof of %d doesn't validate against the root", token.Index)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var verifyMetadata = flag.Bool("verify-metadata", true, "fail when a token's metadata attributes don't match the layers composited into its image")
+var shuffleAttributes = flag.Bool("shuffle-attributes", false, "list the metadata attributes of every token in its own order, drawn from the seed and index (the image keeps the layer order)")
+
+// attributeOrderSalt salts the -shuffle-attributes order.
+const attributeOrderSalt = 0x6f726465
+
+type Attribute struct {
+	TraitType string `json:"trait_type"`
+	Value     string `json:"value"`
+	// Rarity is the percentage of tokens with this value, see -attribute-rarity.
+	Rarity *float64 `json:"rarity,omitempty"`
+}
+
+type Metadata struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image"`
+	// ExternalURL is the token page encoded in the -qr-url code.
+	ExternalURL string      `json:"external_url,omitempty"`
+	Attributes  []Attribute `json:"attributes"`
+	// Localization holds the name and description per LOCALES entry.
+	Localization map[string]LocalizedText `json:"localization,omitempty"`
+	// ColorShifts lists the HSV shifts applied to recolorable traits.
+	ColorShifts []ColorShift `json:"color_shifts,omitempty"`
+	// Jitter is the placement change of a -base variation.
+	Jitter *Jitter `json:"jitter,omitempty"`
+	// Scatter lists the -scatter sprites drawn over the token.
+	Scatter *Scatter `json:"scatter,omitempty"`
+}
+
+var dirOrderPrefix = regexp.MustCompile(`^\d+[\s_-]*`)
+
+// getTraitType returns the trait_type of a directory: DIR<n>_TRAIT if set,
+// otherwise the directory name without its leading order number.
+func getTraitType(dir LayerDir) string {
+	if trait := os.Getenv(dir.Key + "_TRAIT"); trait != "" {
+		return trait
+	}
+	name := filepath.Base(dir.Path)
+	if trait := dirOrderPrefix.ReplaceAllString(name, ""); trait != "" {
+		return trait
+	}
+	return name
+}
+
+// checkTraitTypes makes sure every directory has its own trait_type, as
+// attributes of two directories sharing one couldn't be told apart.
+func checkTraitTypes(dirs []LayerDir) error {
+	keys := map[string]string{}
+	for _, dir := range dirs {
+		trait := getTraitType(dir)
+		if other, ok := keys[trait]; ok {
+			return fmt.Errorf("%s and %s both have trait_type '%s', set %s_TRAIT to tell them apart", other, dir.Key, trait, dir.Key)
+		}
+		keys[trait] = dir.Key
+	}
+	return nil
+}
+
+// normalizeName turns a layer file name into an attribute value, dropping
+// the extension and any #weight suffix.
+func normalizeName(fileName string) string {
+	name, _ := splitWeight(fileName)
+	return name
+}
+
+func buildMetadata(i int, layers []Layer) Metadata {
+	meta := Metadata{
+		Name:        expandTemplate(defaultEnv("NAME", "#{index}"), i),
+		Description: expandTemplate(os.Getenv("DESCRIPTION"), i),
+		Image:       fmt.Sprintf("%d%s", i, getFormatExtension(getOutputFormat())),
+		ExternalURL: getQRURL(i),
+		Attributes:  []Attribute{},
+	}
+	meta.Localization = buildLocalization(i, meta.Name, meta.Description)
+	meta.Scatter = getScatter(i, compositeBounds(layers))
+	var lastShift *ColorShift
+	for _, layer := range layers {
+		meta.Attributes = append(meta.Attributes, Attribute{TraitType: layer.Trait, Value: attributeValue(layer)})
+
+		// Group members share their directory's shift, record it once
+		if layer.Shift != nil && layer.Shift != lastShift {
+			meta.ColorShifts = append(meta.ColorShifts, *layer.Shift)
+			lastShift = layer.Shift
+		}
+	}
+	if *shuffleAttributes {
+		shuffleAttributeOrder(i, meta.Attributes)
+	}
+	return meta
+}
+
+// shuffleAttributeOrder reorders the attributes of token i in place, the
+// same way for the same seed and index.
+func shuffleAttributeOrder(i int, attrs []Attribute) {
+	rng := saltedRandomizer(attributeOrderSalt, i)
+	for a := len(attrs) - 1; a > 0; a-- {
+		b := rng.Intn(a + 1)
+		attrs[a], attrs[b] = attrs[b], attrs[a]
+	}
+}
+
+// checkMetadata reports any difference between the attributes of meta and
+// drawn, the layers composited into the token's image. Absent layers have
+// a None attribute but nothing drawn, and the layers above -layers-limit
+// are listed without being drawn.
+func checkMetadata(meta Metadata, drawn []Layer) error {
+	key := func(traitType, value string) string {
+		return fmt.Sprintf("%q: %q", traitType, value)
+	}
+
+	want := map[string]int{}
+	for _, layer := range drawn {
+		want[key(layer.Trait, attributeValue(layer))]++
+	}
+
+	limited := *layersLimit > 0 && len(drawn) == *layersLimit
+	var diffs []string
+	for _, attr := range meta.Attributes {
+		attrKey := key(attr.TraitType, attr.Value)
+		switch {
+		case want[attrKey] > 0:
+			want[attrKey]--
+		case attr.Value != noneTrait && !limited:
+			diffs = append(diffs, "unexpected "+attrKey)
+		}
+	}
+	for attr, n := range want {
+		if n > 0 {
+			diffs = append(diffs, "missing "+attr)
+		}
+	}
+	if len(diffs) == 0 {
+		return nil
+	}
+
+	sort.Strings(diffs)
+	return fmt.Errorf("metadata of '%s' doesn't match its layers: %s", meta.Name, strings.Join(diffs, ", "))
+}
+
+// encodeMetadata returns the contents of a token's metadata file.
+func encodeMetadata(meta Metadata) ([]byte, error) {
+	return encodeJSON(meta)
+}
+
+func saveMetadataToFile(i int, meta Metadata, outputDir string) {
+	data, err := encodeMetadata(meta)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	outFileName := fmt.Sprintf("%d.json", i)
+	err = os.WriteFile(filepath.Join(getTokenDir(outputDir, i), outFileName), data, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCheckMetadata(t *testing.T) {
+	layer := func(trait, name string) Layer {
+		return Layer{Name: name, Trait: trait, Path: trait + "/" + name, Image: solid(2, 2, color.White)}
+	}
+	absent := Layer{Name: noneTrait, Trait: "Hat"}
+	token := []Layer{layer("Background", "blue.png"), layer("Body", "robot.png"), absent, layer("Eyes", "laser.png")}
+
+	tests := []struct {
+		name        string
+		layersLimit string
+		// desync changes the drawn layers after the metadata is built
+		desync func(drawn []Layer) []Layer
+		// errs are the differences reported, none if empty
+		errs []string
+	}{
+		{"in sync", "0", nil, nil},
+		{"drawn layer swapped", "0", func(drawn []Layer) []Layer {
+			drawn[1] = layer("Body", "alien.png")
+			return drawn
+		}, []string{`missing "Body": "alien"`, `unexpected "Body": "robot"`}},
+		{"layer not drawn", "0", func(drawn []Layer) []Layer {
+			return drawn[:2]
+		}, []string{`unexpected "Eyes": "laser"`}},
+		{"absent layer drawn", "0", func(drawn []Layer) []Layer {
+			return append(drawn, layer("Hat", "cap.png"))
+		}, []string{`missing "Hat": "cap"`}},
+		{"layers limit leaves the top out", "1", nil, nil},
+		{"layers limit still checks the drawn layers", "2", func(drawn []Layer) []Layer {
+			drawn[0] = layer("Background", "red.png")
+			return drawn
+		}, []string{`missing "Background": "red"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, "layers-limit", tt.layersLimit)
+			layers := append([]Layer{}, token...)
+			meta := buildMetadata(1, layers)
+
+			drawn := drawnLayers(layers)
+			if tt.desync != nil {
+				drawn = tt.desync(drawn)
+			}
+			err := checkMetadata(meta, drawn)
+
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("desync not caught")
+			}
+			for _, diff := range tt.errs {
+				if !strings.Contains(err.Error(), diff) {
+					t.Errorf("%q doesn't report %s", err, diff)
+				}
+			}
+		})
+	}
+}
+
+func TestShuffleAttributes(t *testing.T) {
+	var layers []Layer
+	for _, trait := range []string{"Background", "Body", "Eyes", "Mouth", "Hat", "Badge"} {
+		layers = append(layers, Layer{Name: strings.ToLower(trait) + ".png", Trait: trait, Path: trait + "/" + strings.ToLower(trait) + ".png"})
+	}
+	layers = append(layers, Layer{Name: noneTrait, Trait: "Pet"})
+	order := func(meta Metadata) string {
+		var traits []string
+		for _, attr := range meta.Attributes {
+			traits = append(traits, attr.TraitType)
+		}
+		return strings.Join(traits, ",")
+	}
+
+	tests := []struct {
+		name string
+		seed string
+	}{
+		{"seed 1", "1"},
+		{"seed 77", "77"},
+		{"negative seed", "-5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, "seed", tt.seed)
+			setFlag(t, "shuffle-attributes", "false")
+			fixed := buildMetadata(1, layers)
+			setFlag(t, "shuffle-attributes", "true")
+
+			orders := map[string]bool{}
+			for i := 1; i <= 20; i++ {
+				meta := buildMetadata(i, layers)
+				if again := buildMetadata(i, layers); order(again) != order(meta) {
+					t.Errorf("token %d: order %s, then %s", i, order(meta), order(again))
+				}
+				orders[order(meta)] = true
+
+				// Every attribute is still there exactly once
+				want := append([]Attribute{}, fixed.Attributes...)
+				got := append([]Attribute{}, meta.Attributes...)
+				byTrait := func(a, b Attribute) int { return strings.Compare(a.TraitType, b.TraitType) }
+				slices.SortFunc(want, byTrait)
+				slices.SortFunc(got, byTrait)
+				if !slices.Equal(got, want) {
+					t.Errorf("token %d: attributes %v, want %v", i, got, want)
+				}
+			}
+			if len(orders) < 15 {
+				t.Errorf("only %d orders in 20 tokens", len(orders))
+			}
+		})
+	}
+}
+
+func TestShuffleAttributesKeepsImage(t *testing.T) {
+	work := t.TempDir()
+	writeLayers(t, filepath.Join(work, "1 Background"), "red.png", "blue.png")
+	writeLayers(t, filepath.Join(work, "2 Body"), "round.png", "tall.png")
+	writeLayers(t, filepath.Join(work, "3 Hat"), "cap.png", "fez.png")
+	env := []string{"DIR1=1 Background", "DIR2=2 Body", "DIR3=3 Hat", "NFT_COUNT=6"}
+	mustRunMixer(t, work, append(env, "OUTPUT_DIR=plain"), "-seed", "4")
+	mustRunMixer(t, work, append(env, "OUTPUT_DIR=shuffled"), "-seed", "4", "-shuffle-attributes")
+
+	plain := mustReadTree(t, filepath.Join(work, "plain"))
+	shuffled := mustReadTree(t, filepath.Join(work, "shuffled"))
+	for i := 1; i <= 6; i++ {
+		name := strconv.Itoa(i) + ".png"
+		if !bytes.Equal(plain[name], shuffled[name]) {
+			t.Errorf("%s changed with -shuffle-attributes", name)
+		}
+	}
+}
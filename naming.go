@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+var nameBy = flag.String("name-by", "index", "name output images by 'index' (1.png) or content 'hash' (<sha256>.png, listed in hashes.json)")
+
+// hashFileName returns the content addressed file name of encoded image data.
+func hashFileName(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) + getFormatExtension(getOutputFormat())
+}
+
+// HashEntry maps a token index to its hash named image, relative to the
+// output directory.
+type HashEntry struct {
+	Index int    `json:"index"`
+	File  string `json:"file"`
+}
+
+// hashIndex collects the files written by concurrent image workers.
+type hashIndex struct {
+	mu      sync.Mutex
+	entries []HashEntry
+}
+
+func (h *hashIndex) add(i int, file string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries = append(h.entries, HashEntry{Index: i, File: filepath.ToSlash(file)})
+}
+
+// save writes hashes.json ordered by token index.
+func (h *hashIndex) save(outputDir string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sort.Slice(h.entries, func(i, j int) bool {
+		return h.entries[i].Index < h.entries[j].Index
+	})
+
+	data, err := encodeJSON(h.entries)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(outputDir, "hashes.json"), data, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
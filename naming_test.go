@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestNameByHash(t *testing.T) {
+	hashName := regexp.MustCompile(`^[0-9a-f]{64}\.png$`)
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"flat output", nil},
+		{"chunked output", []string{"-chunk-size", "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "red.png", "blue.png", "green.png")
+			writeLayers(t, filepath.Join(work, "2 Eyes"), "round.png", "sleepy.png")
+			env := []string{"DIR1=1 Background", "DIR2=2 Eyes", "NFT_COUNT=5", "OUTPUT_DIR=out"}
+			mustRunMixer(t, work, env, append([]string{"-seed", "4", "-name-by", "hash"}, tt.args...)...)
+			out := filepath.Join(work, "out")
+
+			var entries []HashEntry
+			readJSON(t, filepath.Join(out, "hashes.json"), &entries)
+			if len(entries) != 5 {
+				t.Fatalf("hashes.json has %d entries, want 5", len(entries))
+			}
+			files := map[string]bool{}
+			for n, entry := range entries {
+				if entry.Index != n+1 {
+					t.Errorf("entry %d is for index %d", n, entry.Index)
+				}
+				name := path.Base(entry.File)
+				if !hashName.MatchString(name) {
+					t.Errorf("index %d is named %s", entry.Index, entry.File)
+				}
+				data, err := os.ReadFile(filepath.Join(out, filepath.FromSlash(entry.File)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				sum := sha256.Sum256(data)
+				if hex.EncodeToString(sum[:])+".png" != name {
+					t.Errorf("%s doesn't hold the image it's named after", entry.File)
+				}
+
+				// The token's metadata points at the same file
+				var meta Metadata
+				readJSON(t, filepath.Join(out, filepath.Dir(filepath.FromSlash(entry.File)), strconv.Itoa(entry.Index)+".json"), &meta)
+				if meta.Image != name {
+					t.Errorf("metadata of %d names image %s, hashes.json %s", entry.Index, meta.Image, name)
+				}
+				files[entry.File] = true
+			}
+			if len(files) != 5 {
+				t.Errorf("5 tokens map to %d files", len(files))
+			}
+		})
+	}
+}
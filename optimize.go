@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+var optimize = flag.Bool("optimize", false, "shrink PNGs by clearing the color of fully transparent pixels and writing the smallest color type that holds the image exactly (gray or a palette of up to 256 colors)")
+
+// optimizeForCompression sets the color of every fully transparent pixel
+// of img to zero. Such pixels look the same whatever their color, and long
+// runs of zeros compress much better than leftover color.
+func optimizeForCompression(img *image.RGBA) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		if img.Pix[i+3] == 0 {
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2] = 0, 0, 0
+		}
+	}
+}
+
+// reduceColorType returns img as an 8-bit gray image if it's opaque and
+// gray, as a paletted image if it has at most 256 colors, and unchanged
+// otherwise. The png encoder already drops the alpha channel of opaque
+// images itself.
+func reduceColorType(img *image.RGBA) image.Image {
+	bounds := img.Bounds()
+	if isOpaqueGray(img) {
+		result := image.NewGray(bounds)
+		draw.Draw(result, bounds, img, bounds.Min, draw.Src)
+		return result
+	}
+
+	palette := color.Palette{}
+	index := map[color.RGBA]uint8{}
+	for i := 0; i < len(img.Pix); i += 4 {
+		c := color.RGBA{img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3]}
+		if _, ok := index[c]; ok {
+			continue
+		}
+		if len(palette) == 256 {
+			return img
+		}
+		index[c] = uint8(len(palette))
+		palette = append(palette, c)
+	}
+
+	result := image.NewPaletted(bounds, palette)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			result.SetColorIndex(x, y, index[img.RGBAAt(x, y)])
+		}
+	}
+	return result
+}
+
+func isOpaqueGray(img *image.RGBA) bool {
+	for i := 0; i < len(img.Pix); i += 4 {
+		if img.Pix[i+3] != 255 || img.Pix[i] != img.Pix[i+1] || img.Pix[i+1] != img.Pix[i+2] {
+			return false
+		}
+	}
+	return true
+}
+
+// optimizedCopy returns a copy of img with optimizeForCompression applied,
+// leaving img itself untouched.
+func optimizedCopy(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	result := image.NewRGBA(bounds)
+	draw.Draw(result, bounds, img, bounds.Min, draw.Src)
+	optimizeForCompression(result)
+	return result
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"testing"
+)
+
+func TestOptimizedPNG(t *testing.T) {
+	// sprite is a few flat shapes on a transparent background still
+	// holding the color of whatever was erased there
+	sprite := func() *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+		for y := 0; y < 64; y++ {
+			for x := 0; x < 64; x++ {
+				c := color.RGBA{uint8(x * 4), uint8(y * 4), 90, 0}
+				switch dx, dy := x-32, y-32; {
+				case dx*dx+dy*dy < 200:
+					c = color.RGBA{200, 30, 30, 255}
+				case dx*dx+dy*dy < 400:
+					c = color.RGBA{40, 10, 60, 128}
+				case y > 56:
+					c = color.RGBA{20, 80, 20, 255}
+				}
+				img.SetRGBA(x, y, c)
+			}
+		}
+		return img
+	}
+	gray := func() *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+		for y := 0; y < 64; y++ {
+			for x := 0; x < 64; x++ {
+				v := uint8((x + y) * 2)
+				img.SetRGBA(x, y, color.RGBA{v, v, v, 255})
+			}
+		}
+		return img
+	}
+	noisy := func() *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+		draw.Draw(img, img.Bounds(), noisyImage(3, 64), image.Point{}, draw.Src)
+		return img
+	}
+
+	tests := []struct {
+		name      string
+		img       *image.RGBA
+		interlace bool
+		// smaller is false when nothing can be saved
+		smaller bool
+	}{
+		{"sprite to palette", sprite(), false, true},
+		{"opaque gray", gray(), false, true},
+		{"too many colors", noisy(), false, false},
+		{"interlaced sprite", sprite(), true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var plain, optimized bytes.Buffer
+			if err := encodeImage(&plain, tt.img, "png", WithInterlace(tt.interlace)); err != nil {
+				t.Fatal(err)
+			}
+			original := append([]uint8{}, tt.img.Pix...)
+			if err := encodeImage(&optimized, tt.img, "png", WithInterlace(tt.interlace), WithOptimize(true)); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(tt.img.Pix, original) {
+				t.Error("optimizing changed the image passed in")
+			}
+
+			cleared := optimizedCopy(tt.img)
+			for p := 0; p < len(cleared.Pix); p += 4 {
+				if cleared.Pix[p+3] == 0 && (cleared.Pix[p] != 0 || cleared.Pix[p+1] != 0 || cleared.Pix[p+2] != 0) {
+					t.Fatalf("transparent pixel %d keeps its color %v", p/4, cleared.Pix[p:p+3])
+				}
+			}
+
+			switch {
+			case tt.smaller && optimized.Len() >= plain.Len():
+				t.Errorf("optimized PNG is %d bytes, plain %d", optimized.Len(), plain.Len())
+			case optimized.Len() > plain.Len():
+				t.Errorf("optimized PNG grew from %d to %d bytes", plain.Len(), optimized.Len())
+			}
+
+			// Both look the same composited over any background
+			want, err := png.Decode(&plain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := png.Decode(&optimized)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, background := range []color.Color{color.Black, color.White, color.RGBA{90, 160, 30, 255}} {
+				a, b := image.NewRGBA(want.Bounds()), image.NewRGBA(got.Bounds())
+				draw.Draw(a, a.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+				draw.Draw(b, b.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+				draw.Draw(a, a.Bounds(), want, want.Bounds().Min, draw.Over)
+				draw.Draw(b, b.Bounds(), got, got.Bounds().Min, draw.Over)
+				if !bytes.Equal(a.Pix, b.Pix) {
+					t.Errorf("composited over %v the optimized image differs", background)
+				}
+			}
+		})
+	}
+}
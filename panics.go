@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+)
+
+var maxWorkerPanics = flag.Int("max-worker-panics", 0, "keep generating after up to N tokens panicked in a write worker (0 aborts on the first)")
+
+// workerPanic is a panic recovered while a worker handled token i.
+type workerPanic struct {
+	i     int
+	stage string
+	err   interface{}
+}
+
+// panicCollector receives the panics of all workers, so one failing token
+// is reported instead of crashing the process.
+type panicCollector struct {
+	panics chan workerPanic
+	done   chan struct{}
+	failed []workerPanic
+}
+
+func newPanicCollector() *panicCollector {
+	c := &panicCollector{panics: make(chan workerPanic), done: make(chan struct{})}
+	go func() {
+		defer close(c.done)
+		for p := range c.panics {
+			log.Printf("Worker panicked on NFT %d while writing its %s: %v", p.i, p.stage, p.err)
+			c.failed = append(c.failed, p)
+			if len(c.failed) > *maxWorkerPanics {
+				log.Fatalf("Aborting after %d worker panics (-max-worker-panics %d)", len(c.failed), *maxWorkerPanics)
+			}
+		}
+	}()
+	return c
+}
+
+// run calls job and reports a panic of it as a failure of token i.
+func (c *panicCollector) run(i int, stage string, job func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.panics <- workerPanic{i: i, stage: stage, err: r}
+		}
+	}()
+	job()
+}
+
+// close waits for every reported panic and lists the tokens that weren't
+// written. It must be called once all workers have returned.
+func (c *panicCollector) close() {
+	close(c.panics)
+	<-c.done
+	if len(c.failed) == 0 {
+		return
+	}
+
+	indexes := make([]int, len(c.failed))
+	for n, p := range c.failed {
+		indexes[n] = p.i
+	}
+	sort.Ints(indexes)
+	fmt.Printf("Warning: %d NFTs failed and are missing from the output: %v\n", len(indexes), indexes)
+}
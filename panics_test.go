@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWorkerPanicRecovery(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		max     int
+		// panicAt lists the tokens whose job panics with value
+		panicAt []int
+		value   any
+	}{
+		{"one panic, one worker", 1, 1, []int{3}, "injected"},
+		{"one panic, many workers", 4, 1, []int{7}, "injected"},
+		{"several panics under the limit", 3, 5, []int{2, 9, 15}, "injected"},
+		{"panic with an error value", 2, 1, []int{1}, fmt.Errorf("disk full")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, "max-worker-panics", fmt.Sprint(tt.max))
+			logs := captureLog(t)
+			panics := newPanicCollector()
+
+			jobs := make(chan int)
+			var mu sync.Mutex
+			var written []int
+			var wg sync.WaitGroup
+			for w := 0; w < tt.workers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := range jobs {
+						panics.run(i, "image", func() {
+							if slices.Contains(tt.panicAt, i) {
+								panic(tt.value)
+							}
+							mu.Lock()
+							written = append(written, i)
+							mu.Unlock()
+						})
+					}
+				}()
+			}
+			for i := 1; i <= 20; i++ {
+				jobs <- i
+			}
+			close(jobs)
+			wg.Wait()
+			panics.close()
+
+			// Every other token was still written
+			sort.Ints(written)
+			var want []int
+			for i := 1; i <= 20; i++ {
+				if !slices.Contains(tt.panicAt, i) {
+					want = append(want, i)
+				}
+			}
+			if !reflect.DeepEqual(written, want) {
+				t.Errorf("wrote %v, want %v", written, want)
+			}
+
+			var failed []int
+			for _, p := range panics.failed {
+				failed = append(failed, p.i)
+			}
+			sort.Ints(failed)
+			if !reflect.DeepEqual(failed, tt.panicAt) {
+				t.Errorf("reported %v, want %v", failed, tt.panicAt)
+			}
+			for _, i := range tt.panicAt {
+				if !strings.Contains(logs.String(), fmt.Sprintf("Worker panicked on NFT %d while writing its image: %v", i, tt.value)) {
+					t.Errorf("NFT %d isn't in the log:\n%s", i, logs)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PreprocessStep is one operation of a directory's preprocessing pipeline.
+type PreprocessStep struct {
+	// Op is resize, outline, shadow or feather.
+	Op string
+	// Size is the longest side for resize and the width in pixels for
+	// outline, shadow and feather.
+	Size  int
+	Color color.NRGBA
+}
+
+// Pipeline runs on every file of a directory once, right after decoding.
+type Pipeline []PreprocessStep
+
+// String returns the pipeline in its DIR<n>_PREPROCESS form.
+func (p Pipeline) String() string {
+	steps := make([]string, len(p))
+	for i, step := range p {
+		steps[i] = fmt.Sprintf("%s:%d:%02x%02x%02x", step.Op, step.Size, step.Color.R, step.Color.G, step.Color.B)
+	}
+	return strings.Join(steps, ",")
+}
+
+// getPipeline parses <prefix>_PREPROCESS, a comma separated list of
+// resize:N, outline:PX[:RRGGBB], shadow:PX[:RRGGBB] and feather:PX steps run
+// in order. Outlines and shadows are black unless a color is given.
+// <prefix>_FEATHER=PX adds a feather step at the end.
+func getPipeline(prefix string) Pipeline {
+	var specs []string
+	if value := os.Getenv(prefix + "_PREPROCESS"); value != "" {
+		specs = strings.Split(value, ",")
+	}
+	if feather := os.Getenv(prefix + "_FEATHER"); feather != "" {
+		if n, err := strconv.Atoi(feather); err != nil || n < 1 {
+			log.Fatalf("Invalid %s_FEATHER value '%s'", prefix, feather)
+		}
+		specs = append(specs, "feather:"+feather)
+	}
+
+	var pipeline Pipeline
+	for _, spec := range specs {
+		parts := strings.Split(strings.TrimSpace(spec), ":")
+		step := PreprocessStep{Op: parts[0], Color: color.NRGBA{0, 0, 0, 255}}
+
+		invalid := len(parts) < 2 || len(parts) > 3
+		if !invalid {
+			n, err := strconv.Atoi(parts[1])
+			invalid = err != nil || n < 1
+			step.Size = n
+		}
+		switch {
+		case invalid:
+		case step.Op == "resize" || step.Op == "feather":
+			invalid = len(parts) != 2
+		case step.Op == "outline" || step.Op == "shadow":
+			if len(parts) == 3 {
+				rgb, err := strconv.ParseUint(strings.TrimPrefix(parts[2], "#"), 16, 32)
+				invalid = err != nil || len(strings.TrimPrefix(parts[2], "#")) != 6
+				step.Color = color.NRGBA{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb), 255}
+			}
+		default:
+			invalid = true
+		}
+		if invalid {
+			log.Fatalf("Invalid %s_PREPROCESS step '%s', expected resize:N, outline:PX[:RRGGBB], shadow:PX[:RRGGBB] or feather:PX", prefix, spec)
+		}
+
+		pipeline = append(pipeline, step)
+	}
+	return pipeline
+}
+
+// preprocessed holds the pipeline output of every layer file, keyed by path
+// and pipeline, so each file is processed once per run.
+var preprocessed = struct {
+	sync.Mutex
+	images map[string]image.Image
+}{images: map[string]image.Image{}}
+
+// loadLayerImage decodes the file of layer and runs its pipeline, reusing
+// the result of an earlier call for the same file.
+func loadLayerImage(layer Layer) (image.Image, error) {
+	if len(layer.Preprocess) == 0 {
+		return decodeLayer(layer.Path, layer.Gray)
+	}
+
+	key := layer.Path + "|" + layer.Preprocess.String()
+	preprocessed.Lock()
+	img, ok := preprocessed.images[key]
+	preprocessed.Unlock()
+	if ok {
+		return img, nil
+	}
+
+	img, err := decodeLayer(layer.Path, layer.Gray)
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range layer.Preprocess {
+		img = step.apply(img)
+	}
+
+	// Workers racing on the same file compute identical images, so the
+	// last store winning is harmless
+	preprocessed.Lock()
+	preprocessed.images[key] = img
+	preprocessed.Unlock()
+	return img, nil
+}
+
+func (step PreprocessStep) apply(img image.Image) image.Image {
+	switch step.Op {
+	case "resize":
+		w, h := scaleLongestSide(img.Bounds(), step.Size)
+		return resizeImage(img, w, h)
+	case "outline":
+		return underlay(img, dilateAlpha(img, step.Size), step.Color, image.Point{})
+	case "shadow":
+		shadow := step.Color
+		shadow.A = 128
+		return underlay(img, alphaOf(img), shadow, image.Pt(step.Size, step.Size))
+	case "feather":
+		return featherAlpha(img, step.Size)
+	}
+	return img
+}
+
+func alphaOf(img image.Image) *image.Alpha {
+	alpha := image.NewAlpha(img.Bounds())
+	draw.Draw(alpha, alpha.Bounds(), img, img.Bounds().Min, draw.Src)
+	return alpha
+}
+
+// dilateAlpha grows the opaque area of img by radius pixels in every
+// direction.
+func dilateAlpha(img image.Image, radius int) *image.Alpha {
+	src := alphaOf(img)
+	bounds := src.Bounds()
+	dilated := image.NewAlpha(bounds)
+
+	var disk []image.Point
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			if dx*dx+dy*dy <= radius*radius {
+				disk = append(disk, image.Pt(dx, dy))
+			}
+		}
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			var max uint8
+			for _, d := range disk {
+				p := image.Pt(x+d.X, y+d.Y)
+				if !p.In(bounds) {
+					continue
+				}
+				if a := src.AlphaAt(p.X, p.Y).A; a > max {
+					max = a
+					if max == 255 {
+						break
+					}
+				}
+			}
+			dilated.SetAlpha(x, y, color.Alpha{max})
+		}
+	}
+	return dilated
+}
+
+// featherAlpha softens the edges of img: the alpha of every pixel is
+// lowered to the average alpha within radius pixels, so opaque areas fade
+// out over radius pixels towards transparent ones. Colors are kept and
+// nothing grows outwards. Past the image border the edge pixels repeat, so
+// a layer covering the whole canvas keeps its hard borders.
+func featherAlpha(img image.Image, radius int) image.Image {
+	bounds := img.Bounds()
+	result := image.NewNRGBA(bounds)
+	draw.Draw(result, bounds, img, bounds.Min, draw.Src)
+
+	w, h := bounds.Dx(), bounds.Dy()
+	alpha := make([]int, w*h)
+	for p := range alpha {
+		alpha[p] = int(result.Pix[p*4+3])
+	}
+
+	// Separable box blur, clamping coordinates at the border
+	clamp := func(v, n int) int {
+		return min(max(v, 0), n-1)
+	}
+	blurred := make([]int, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sum := 0
+			for d := -radius; d <= radius; d++ {
+				sum += alpha[y*w+clamp(x+d, w)]
+			}
+			blurred[y*w+x] = sum
+		}
+	}
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			sum := 0
+			for d := -radius; d <= radius; d++ {
+				sum += blurred[clamp(y+d, h)*w+x]
+			}
+			alpha[y*w+x] = min(alpha[y*w+x], sum/((2*radius+1)*(2*radius+1)))
+		}
+	}
+
+	for p, a := range alpha {
+		result.Pix[p*4+3] = uint8(a)
+	}
+	return result
+}
+
+// underlay draws c through mask, moved by offset, beneath img.
+func underlay(img image.Image, mask *image.Alpha, c color.NRGBA, offset image.Point) *image.RGBA {
+	bounds := img.Bounds()
+	result := image.NewRGBA(bounds)
+
+	fill := &image.Uniform{c}
+	draw.DrawMask(result, bounds.Add(offset), fill, image.Point{}, mask, bounds.Min, draw.Src)
+	draw.Draw(result, bounds, img, bounds.Min, draw.Over)
+	return result
+}
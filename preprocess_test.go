@@ -0,0 +1,160 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"testing"
+)
+
+func TestPreprocessPipeline(t *testing.T) {
+	red := color.NRGBA{255, 0, 0, 255}
+	tests := []struct {
+		name     string
+		pipeline string
+		size     int
+		// ring is the color just outside the red square, nil for transparent
+		ring *color.NRGBA
+	}{
+		{"resize only", "resize:16", 16, nil},
+		{"resize then outline", "resize:16,outline:2", 16, &color.NRGBA{0, 0, 0, 191}},
+		{"resize then colored outline", "resize:16, outline:2:00ff00", 16, &color.NRGBA{0, 255, 0, 191}},
+		{"outline then resize", "outline:1,resize:16", 16, &color.NRGBA{0, 0, 0, 191}},
+		{"outline only", "outline:1", 8, &color.NRGBA{0, 0, 0, 255}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// An 8x8 layer with a red 4x4 square in the middle
+			path := filepath.Join(t.TempDir(), "Hat", "square.png")
+			img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+			for y := 2; y < 6; y++ {
+				for x := 2; x < 6; x++ {
+					img.SetNRGBA(x, y, red)
+				}
+			}
+			writePNG(t, path, img)
+			t.Setenv("DIR1_PREPROCESS", tt.pipeline)
+			dir := newLayerDir("DIR1", filepath.Dir(path))
+
+			loaded, err := loadLayerImage(newLayer("Hat", dir, path))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := loaded.Bounds(); got != image.Rect(0, 0, tt.size, tt.size) {
+				t.Fatalf("loaded a %v image, want %dx%d", got, tt.size, tt.size)
+			}
+			at := func(x, y int) color.NRGBA { return color.NRGBAModel.Convert(loaded.At(x, y)).(color.NRGBA) }
+
+			mid := tt.size / 2
+			if got := at(mid, mid); got != red {
+				t.Errorf("middle %v, want %v", got, red)
+			}
+			if got := at(0, mid); got.A != 0 {
+				t.Errorf("border %v, want transparent", got)
+			}
+			// The square ends 3 pixels before the border at 16px, 2 at 8px
+			outside := tt.size - 3
+			if tt.size == 8 {
+				outside = 6
+			}
+			got := at(outside, mid)
+			if tt.ring == nil && got.A != 0 || tt.ring != nil && got != *tt.ring {
+				t.Errorf("pixel outside the square %v, want %v", got, tt.ring)
+			}
+		})
+	}
+}
+
+func TestSamplesArePreprocessed(t *testing.T) {
+	root := t.TempDir()
+	writeLayers(t, filepath.Join(root, "1 Background"), "navy.png")
+	writeLayers(t, filepath.Join(root, "2 Hat"), "cap.png", "crown.png")
+	for _, key := range []string{"DIR1", "DIR2"} {
+		t.Setenv(key+"_PREPROCESS", "resize:12,outline:1")
+	}
+	dirs := []LayerDir{
+		newLayerDir("DIR1", filepath.Join(root, "1 Background")),
+		newLayerDir("DIR2", filepath.Join(root, "2 Hat")),
+	}
+	out := filepath.Join(root, "samples")
+	if err := generateTraitSamples("Hat", dirs, out); err != nil {
+		t.Fatal(err)
+	}
+
+	// The samples go through the pipeline the generated tokens do
+	for _, name := range []string{"cap.png", "crown.png"} {
+		layers := []Layer{
+			newLayer("Background", dirs[0], filepath.Join(root, "1 Background", "navy.png")),
+			newLayer("Hat", dirs[1], filepath.Join(root, "2 Hat", name)),
+		}
+		if err := loadLayers(layers); err != nil {
+			t.Fatal(err)
+		}
+		want := applyMask(combineLayers(layers))
+		got := readPNG(t, filepath.Join(out, name))
+		if got.Bounds() != image.Rect(0, 0, 12, 12) {
+			t.Fatalf("%s is %v, want 12x12", name, got.Bounds())
+		}
+		for y := 0; y < 12; y++ {
+			for x := 0; x < 12; x++ {
+				if g, w := color.NRGBAModel.Convert(got.At(x, y)), color.NRGBAModel.Convert(want.At(x, y)); g != w {
+					t.Fatalf("%s pixel %d,%d is %v, want %v", name, x, y, g, w)
+				}
+			}
+		}
+	}
+}
+
+func TestFeatherAlpha(t *testing.T) {
+	tests := []struct {
+		name   string
+		opaque image.Rectangle
+		radius int
+		// alpha along row 10 by column, the unfeathered layer is 0 or 255
+		row map[int]uint8
+	}{
+		{"centered square", image.Rect(5, 5, 15, 15), 3, map[int]uint8{
+			4: 0, 5: 145, 6: 182, 7: 218, 8: 255, 11: 255, 12: 218, 13: 182, 14: 145, 15: 0,
+		}},
+		{"small radius", image.Rect(5, 5, 15, 15), 1, map[int]uint8{
+			4: 0, 5: 170, 6: 255, 13: 255, 14: 170, 15: 0,
+		}},
+		{"touching the border", image.Rect(0, 0, 10, 20), 3, map[int]uint8{
+			0: 255, 3: 255, 6: 255, 7: 218, 8: 182, 9: 145, 10: 0,
+		}},
+		{"whole canvas", image.Rect(0, 0, 20, 20), 3, map[int]uint8{
+			0: 255, 1: 255, 10: 255, 18: 255, 19: 255,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := color.NRGBA{30, 120, 200, 255}
+			layer := image.NewNRGBA(image.Rect(0, 0, 20, 20))
+			for y := tt.opaque.Min.Y; y < tt.opaque.Max.Y; y++ {
+				for x := tt.opaque.Min.X; x < tt.opaque.Max.X; x++ {
+					layer.SetNRGBA(x, y, c)
+				}
+			}
+
+			feathered := featherAlpha(layer, tt.radius)
+			for x, want := range tt.row {
+				got := color.NRGBAModel.Convert(feathered.At(x, 10)).(color.NRGBA)
+				if got.A != want {
+					t.Errorf("alpha at x=%d is %d, unfeathered %d, want %d", x, got.A, layer.NRGBAAt(x, 10).A, want)
+				}
+				if got.A > 0 && (got.R != c.R || got.G != c.G || got.B != c.B) {
+					t.Errorf("color at x=%d changed to %v", x, got)
+				}
+			}
+
+			// Nothing outside the layer turns visible
+			for y := 0; y < 20; y++ {
+				for x := 0; x < 20; x++ {
+					if !image.Pt(x, y).In(tt.opaque) && color.NRGBAModel.Convert(feathered.At(x, y)).(color.NRGBA).A != 0 {
+						t.Fatalf("transparent pixel %d,%d got alpha", x, y)
+					}
+				}
+			}
+		})
+	}
+}
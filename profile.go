@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"strings"
+)
+
+var normalizeProfiles = flag.Bool("normalize-profiles", false, "strip embedded color profiles and convert gAMA-tagged layers to sRGB gamma before compositing")
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// sRGBGamma is the gAMA chunk value (gamma * 100000) implied by sRGB.
+const sRGBGamma = 45455
+
+// ColorProfile describes the color space chunks embedded in a PNG. The Go
+// decoder ignores all of them, so layers with differing profiles are
+// composited as if they shared one.
+type ColorProfile struct {
+	Gamma uint32 // gAMA value scaled by 100000, 0 when absent
+	SRGB  bool   // sRGB chunk present
+	ICC   string // iCCP profile name, empty when absent
+}
+
+func (p ColorProfile) String() string {
+	var parts []string
+	if p.ICC != "" {
+		parts = append(parts, fmt.Sprintf("ICC '%s'", p.ICC))
+	}
+	if p.SRGB {
+		parts = append(parts, "sRGB")
+	}
+	if p.Gamma != 0 {
+		parts = append(parts, fmt.Sprintf("gamma %.5f", float64(p.Gamma)/100000))
+	}
+	if len(parts) == 0 {
+		return "untagged"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// readColorProfile scans the chunks preceding the image data for gAMA, sRGB
+// and iCCP without decoding any pixels.
+func readColorProfile(r io.Reader) (ColorProfile, error) {
+	var profile ColorProfile
+
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(r, signature); err != nil {
+		return profile, err
+	}
+	if !bytes.Equal(signature, pngSignature) {
+		return profile, errors.New("not a PNG file")
+	}
+
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return profile, err
+		}
+		length := binary.BigEndian.Uint32(header[:4])
+		chunkType := string(header[4:])
+
+		// Color space chunks must appear before the first IDAT
+		if chunkType == "IDAT" || chunkType == "IEND" {
+			return profile, nil
+		}
+
+		// Chunk data plus its trailing CRC
+		data := make([]byte, int(length)+4)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return profile, err
+		}
+		data = data[:length]
+
+		switch chunkType {
+		case "gAMA":
+			if len(data) == 4 {
+				profile.Gamma = binary.BigEndian.Uint32(data)
+			}
+		case "sRGB":
+			profile.SRGB = true
+		case "iCCP":
+			name := data
+			if i := bytes.IndexByte(data, 0); i >= 0 {
+				name = data[:i]
+			}
+			profile.ICC = string(name)
+		}
+	}
+}
+
+// checkColorProfiles reads the profile of every layer file and warns when
+// they are not all the same.
+func checkColorProfiles(dirs []LayerDir) {
+	byProfile := map[string][]string{}
+
+	assets, err := listAssets(dirs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, path := range assets {
+		data, err := layerSource.ReadFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		profile, err := readColorProfile(bytes.NewReader(data))
+		if err != nil {
+			log.Printf("Could not read color profile of '%s': %v", path, err)
+			continue
+		}
+
+		byProfile[profile.String()] = append(byProfile[profile.String()], path)
+	}
+
+	if len(byProfile) < 2 {
+		return
+	}
+
+	profiles := make([]string, 0, len(byProfile))
+	for profile := range byProfile {
+		profiles = append(profiles, profile)
+	}
+	sort.Strings(profiles)
+
+	log.Printf("Warning: layers use %d different color profiles, composites may show color shifts", len(profiles))
+	for _, profile := range profiles {
+		log.Printf("  %s: %d files (e.g. '%s')", profile, len(byProfile[profile]), byProfile[profile][0])
+	}
+	if !*normalizeProfiles {
+		log.Printf("  use -normalize-profiles to convert layers to a common sRGB assumption")
+	}
+}
+
+// normalizeProfile converts the pixels of an image tagged with profile to
+// sRGB gamma. ICC profiles cannot be converted without a color management
+// engine, so those layers are only stripped and treated as sRGB.
+func normalizeProfile(img image.Image, profile ColorProfile) image.Image {
+	if profile.SRGB || profile.ICC != "" || profile.Gamma == 0 || profile.Gamma == sRGBGamma {
+		return img
+	}
+
+	// A sample s decodes to linear light s^(1/g), re-encode it with the sRGB gamma
+	exponent := 100000 / (float64(profile.Gamma) * 2.2)
+	var lut [256]uint8
+	for i := range lut {
+		lut[i] = uint8(math.Round(math.Pow(float64(i)/255, exponent) * 255))
+	}
+
+	bounds := img.Bounds()
+	normalized := image.NewNRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			normalized.SetNRGBA(x, y, color.NRGBA{lut[c.R], lut[c.G], lut[c.B], c.A})
+		}
+	}
+	return normalized
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image/color"
+	"image/png"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withChunk inserts a chunk right after the IHDR of an encoded PNG, where
+// color space chunks go.
+func withChunk(t *testing.T, data []byte, chunkType string, payload []byte) []byte {
+	t.Helper()
+	// Signature, then IHDR: length, type, 13 bytes of data and its CRC
+	ihdrEnd := len(pngSignature) + 8 + 13 + 4
+	if string(data[len(pngSignature)+4:len(pngSignature)+8]) != "IHDR" {
+		t.Fatal("PNG doesn't start with IHDR")
+	}
+
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	chunk = append(chunk, chunkType...)
+	chunk = append(chunk, payload...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	tagged := append([]byte{}, data[:ihdrEnd]...)
+	tagged = append(tagged, chunk...)
+	return append(tagged, data[ihdrEnd:]...)
+}
+
+// taggedLayer returns a small PNG carrying the given color space chunk, or
+// none if chunkType is empty.
+func taggedLayer(t *testing.T, chunkType string, payload []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, solid(2, 2, color.NRGBA{128, 64, 32, 255})); err != nil {
+		t.Fatal(err)
+	}
+	if chunkType == "" {
+		return buf.Bytes()
+	}
+	return withChunk(t, buf.Bytes(), chunkType, payload)
+}
+
+func gamma(g uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, g)
+}
+
+func TestReadColorProfile(t *testing.T) {
+	tests := []struct {
+		name      string
+		chunkType string
+		payload   []byte
+		want      ColorProfile
+	}{
+		{"untagged", "", nil, ColorProfile{}},
+		{"srgb gamma", "gAMA", gamma(sRGBGamma), ColorProfile{Gamma: sRGBGamma}},
+		{"linear gamma", "gAMA", gamma(100000), ColorProfile{Gamma: 100000}},
+		{"srgb chunk", "sRGB", []byte{0}, ColorProfile{SRGB: true}},
+		{"icc profile", "iCCP", []byte("Display P3\x00\x00x"), ColorProfile{ICC: "Display P3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readColorProfile(bytes.NewReader(taggedLayer(t, tt.chunkType, tt.payload)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckColorProfiles(t *testing.T) {
+	tests := []struct {
+		name string
+		// gammas of the background and face files
+		background, face uint32
+		// reported are the profiles the warning lists, none if nil
+		reported []string
+	}{
+		{"same gamma", 45455, 45455, nil},
+		{"different gamma", 45455, 100000, []string{"gamma 0.45455: 1 files", "gamma 1.00000: 1 files"}},
+		{"tagged and untagged", 0, 100000, []string{"untagged: 1 files", "gamma 1.00000: 1 files"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			var dirs []LayerDir
+			for n, g := range []uint32{tt.background, tt.face} {
+				path := filepath.Join(root, []string{"Background", "Face"}[n])
+				data := taggedLayer(t, "", nil)
+				if g != 0 {
+					data = taggedLayer(t, "gAMA", gamma(g))
+				}
+				writeFile(t, filepath.Join(path, "layer.png"), string(data))
+				dirs = append(dirs, LayerDir{Key: "DIR" + string(rune('1'+n)), Path: path, Pick: 1})
+			}
+
+			logged := captureLog(t)
+			checkColorProfiles(dirs)
+
+			if tt.reported == nil {
+				if logged.Len() > 0 {
+					t.Errorf("unexpected warning:\n%s", logged)
+				}
+				return
+			}
+			if !strings.Contains(logged.String(), "2 different color profiles") {
+				t.Errorf("mismatch not reported:\n%s", logged)
+			}
+			for _, profile := range tt.reported {
+				if !strings.Contains(logged.String(), profile) {
+					t.Errorf("warning doesn't list %q:\n%s", profile, logged)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile ColorProfile
+		// want is the red channel of the normalized 128,64,32 pixel
+		want uint8
+	}{
+		{"srgb gamma is kept", ColorProfile{Gamma: sRGBGamma}, 128},
+		{"untagged is kept", ColorProfile{}, 128},
+		{"icc is only stripped", ColorProfile{ICC: "Display P3", Gamma: 100000}, 128},
+		{"linear gamma is brightened", ColorProfile{Gamma: 100000}, 186},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := normalizeProfile(solid(1, 1, color.NRGBA{128, 64, 32, 255}), tt.profile)
+			got := color.NRGBAModel.Convert(img.At(0, 0)).(color.NRGBA)
+			if got.R != tt.want || got.A != 255 {
+				t.Errorf("got %v, want red %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"log"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+var qrURL = flag.String("qr-url", "", "draw a QR code of this URL template ({index} is the token index) on every NFT and record it as external_url")
+var qrSize = flag.Int("qr-size", 64, "side of the -qr-url code in pixels, including its quiet zone")
+var qrPosition = flag.String("qr-position", "", "X,Y of the top-left corner of the QR code (bottom-right corner if empty)")
+
+// getQRURL returns the URL encoded into the QR code of token i, empty when
+// -qr-url isn't set.
+func getQRURL(i int) string {
+	return expandTemplate(*qrURL, i)
+}
+
+// checkQROptions validates -qr-size and -qr-position before generating.
+func checkQROptions() error {
+	if *qrURL == "" {
+		return nil
+	}
+	if *qrSize < 21 {
+		return fmt.Errorf("invalid -qr-size %d, a QR code needs at least 21 pixels", *qrSize)
+	}
+	if *qrPosition != "" {
+		var x, y int
+		_, err := fmt.Sscanf(strings.ReplaceAll(*qrPosition, " ", ""), "%d,%d", &x, &y)
+		if err != nil {
+			return fmt.Errorf("invalid -qr-position '%s', expected X,Y", *qrPosition)
+		}
+	}
+	return nil
+}
+
+// drawQR composites the QR code of token i onto img. The code keeps its
+// white quiet zone so scanners find it on any background.
+func drawQR(i int, img image.Image) image.Image {
+	if *qrURL == "" {
+		return img
+	}
+
+	code, err := qrcode.New(getQRURL(i), qrcode.Medium)
+	if err != nil {
+		log.Fatalf("Could not encode the QR code of NFT %d: %v", i, err)
+	}
+	qr := code.Image(*qrSize)
+
+	bounds := img.Bounds()
+	at := image.Pt(bounds.Max.X-qr.Bounds().Dx(), bounds.Max.Y-qr.Bounds().Dy())
+	if *qrPosition != "" {
+		fmt.Sscanf(strings.ReplaceAll(*qrPosition, " ", ""), "%d,%d", &at.X, &at.Y)
+		at = at.Add(bounds.Min)
+	}
+
+	result := image.NewRGBA(bounds)
+	draw.Draw(result, bounds, img, bounds.Min, draw.Src)
+	draw.Draw(result, qr.Bounds().Add(at), qr, qr.Bounds().Min, draw.Src)
+	return result
+}
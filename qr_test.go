@@ -0,0 +1,86 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+func TestQRCode(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		// at is the top-left corner of the code, nil for the bottom-right
+		// corner of the image
+		at *image.Point
+	}{
+		{"bottom-right", nil, nil},
+		{"positioned", []string{"-qr-position", "10,20"}, &image.Point{10, 20}},
+		{"circle mask over the corner", []string{"-mask", "circle"}, nil},
+		{"rounded mask corner", []string{"-mask", "rounded", "-corner-radius", "40"}, nil},
+		{"masked top-left corner", []string{"-mask", "circle", "-qr-position", "0,0"}, &image.Point{0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			for n, name := range []string{"sea.png", "sand.png"} {
+				writePNG(t, filepath.Join(work, "1 Background", name), solid(99, 99, color.NRGBA{uint8(60 + 100*n), 120, 180, 255}))
+			}
+			env := []string{"DIR1=1 Background", "NFT_COUNT=2", "OUTPUT_DIR=out"}
+			args := append([]string{"-seed", "4", "-qr-url", "https://example.com/token/{index}", "-qr-size", "33"}, tt.args...)
+			mustRunMixer(t, work, env, args...)
+
+			for i := 1; i <= 2; i++ {
+				url := "https://example.com/token/" + strconv.Itoa(i)
+				var meta Metadata
+				readJSON(t, filepath.Join(work, "out", strconv.Itoa(i)+".json"), &meta)
+				if meta.ExternalURL != url {
+					t.Errorf("token %d has external_url %q", i, meta.ExternalURL)
+				}
+
+				// The code is drawn whole, module for module, whatever the mask
+				code, err := qrcode.New(url, qrcode.Medium)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := code.Image(33)
+				size := want.Bounds().Size()
+				at := image.Pt(99-size.X, 99-size.Y)
+				if tt.at != nil {
+					at = *tt.at
+				}
+				img := readPNG(t, filepath.Join(work, "out", strconv.Itoa(i)+".png"))
+				mismatches := 0
+				for y := 0; y < size.Y; y++ {
+					for x := 0; x < size.X; x++ {
+						w := color.NRGBAModel.Convert(want.At(x, y))
+						if got := color.NRGBAModel.Convert(img.At(at.X+x, at.Y+y)); got != w {
+							mismatches++
+						}
+					}
+				}
+				if mismatches > 0 {
+					t.Errorf("token %d: %d of the QR code's pixels differ", i, mismatches)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidQROptions(t *testing.T) {
+	for _, args := range [][]string{{"-qr-size", "20"}, {"-qr-position", "left"}} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "a.png")
+			out, err := runMixer(t, work, []string{"DIR1=1 Background", "NFT_COUNT=1", "OUTPUT_DIR=out"}, append([]string{"-qr-url", "https://example.com"}, args...)...)
+			if err == nil {
+				t.Fatalf("%v accepted:\n%s", args, out)
+			}
+		})
+	}
+}
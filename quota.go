@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+)
+
+var useQuotas = flag.Bool("quotas", false, "treat the file weights of each directory as target shares of NFT_COUNT and weight every draw by the quota still left, so the collection matches them closely and evenly")
+
+// quotaTracker reweights file draws by how far each file is from its target
+// count, like drawing from an urn that holds every file its quota of times.
+// A file that is ahead of its share of the draws so far isn't drawn again
+// until the others catch up, so the targets are met throughout the
+// collection instead of on average.
+type quotaTracker struct {
+	nftCount int
+	// used is the usage of every layer file by the tokens accepted so far.
+	used map[string]int
+}
+
+// quotas is nil unless -quotas is set. It's only used by the sequential
+// selection of the main loop.
+var quotas *quotaTracker
+
+func newQuotaTracker(nftCount int, usage map[string]int) *quotaTracker {
+	return &quotaTracker{nftCount: nftCount, used: usage}
+}
+
+// reweight returns the weights of the files at paths of group, a group of
+// dir, scaled to the quota each has left. Absence and the group draw keep
+// their probabilities, they only set how many draws the group expects.
+func (q *quotaTracker) reweight(dir, group LayerDir, paths []string, weights []float64) []float64 {
+	expected := float64(q.nftCount) * (1 - dir.Absence) * float64(group.Pick) * groupShare(dir, group)
+	shares := normalizeWeights(weights)
+
+	// The group's draws keep the pace of the shares: a file a whole draw
+	// behind its share of them is drawn before the others, and one a whole
+	// draw ahead waits
+	draws := 0
+	for _, path := range paths {
+		draws += q.used[path]
+	}
+	behind := make([]float64, len(weights))
+	catchUp := false
+	for f, share := range shares {
+		behind[f] = share*float64(draws+group.Pick) - float64(q.used[paths[f]])
+		catchUp = catchUp || behind[f] >= 1
+	}
+
+	left := make([]float64, len(weights))
+	total := 0.0
+	for f, share := range shares {
+		if catchUp && behind[f] < 1 || behind[f] <= -1 {
+			continue
+		}
+		if quota := share*expected - float64(q.used[paths[f]]); quota > 0 {
+			left[f] = quota
+			total += quota
+		}
+	}
+
+	// Absence can draw the group more often than expected, once every quota
+	// is used up the weights apply as usual
+	if total <= 0 {
+		return weights
+	}
+	return left
+}
+
+// groupShare returns the probability that group is drawn for dir.
+func groupShare(dir, group LayerDir) float64 {
+	if !dir.Grouped {
+		return 1
+	}
+	groups, err := getLayerGroups(dir)
+	if err != nil {
+		return 1
+	}
+	names := make([]string, len(groups))
+	for g := range groups {
+		names[g] = filepath.Base(groups[g].Path)
+	}
+	shares := normalizeWeights(getFileWeights(names))
+	for g := range groups {
+		if groups[g].Path == group.Path {
+			return shares[g]
+		}
+	}
+	return 1
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestQuotaDistribution(t *testing.T) {
+	tests := []struct {
+		name     string
+		nftCount int
+		// files of the first directory and their target counts
+		files   map[string]int
+		windows int
+	}{
+		{"three files", 48, map[string]int{"red#6.png": 24, "blue#3.png": 12, "green#3.png": 12}, 4},
+		{"rare file", 60, map[string]int{"plain#9.png": 54, "gold#1.png": 6}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			var files []string
+			for file := range tt.files {
+				files = append(files, file)
+			}
+			writeLayers(t, filepath.Join(work, "1 Background"), files...)
+			// Plenty of combinations, so duplicates hardly ever re-roll
+			var eyes []string
+			for e := 0; e < 120; e++ {
+				eyes = append(eyes, fmt.Sprintf("eyes%d.png", e))
+			}
+			writeLayers(t, filepath.Join(work, "2 Eyes"), eyes...)
+			env := []string{"DIR1=1 Background", "DIR2=2 Eyes", fmt.Sprint("NFT_COUNT=", tt.nftCount), "OUTPUT_DIR=out"}
+			mustRunMixer(t, work, env, "-seed", "8", "-quotas")
+
+			var manifest Manifest
+			readJSON(t, filepath.Join(work, "out", "manifest.json"), &manifest)
+			if len(manifest.Tokens) != tt.nftCount {
+				t.Fatalf("%d tokens, want %d", len(manifest.Tokens), tt.nftCount)
+			}
+
+			// Every window of the collection holds its share of each
+			// target, not only the whole collection
+			size := tt.nftCount / tt.windows
+			total := map[string]int{}
+			for w := 0; w < tt.windows; w++ {
+				counts := map[string]int{}
+				for _, token := range manifest.Tokens[w*size : (w+1)*size] {
+					counts[filepath.Base(token.Layers[0].Path)]++
+				}
+				for file, target := range tt.files {
+					want := float64(target) / float64(tt.windows)
+					if got := counts[file]; math.Abs(float64(got)-want) > 1.5 {
+						t.Errorf("tokens %d to %d have %s %d times, want about %.1f", w*size+1, (w+1)*size, file, got, want)
+					}
+					total[file] += counts[file]
+				}
+			}
+			for file, target := range tt.files {
+				if got := total[file]; got != target {
+					t.Errorf("%s is used %d times, target %d", file, got, target)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import "math/rand"
+
+// Randomizer is the source of randomness of the selection code. Replacing
+// newRandomizer swaps the generator for every token, e.g. for a verifiable
+// random function or a scripted source.
+type Randomizer interface {
+	Intn(n int) int
+	Float64() float64
+}
+
+// newRandomizer returns the Randomizer for a derived seed. The default is
+// math/rand seeded with it, never the global source.
+var newRandomizer = func(seed int64) Randomizer {
+	return rand.New(rand.NewSource(seed))
+}
+
+// saltedRandomizer returns the Randomizer of a draw of token i that isn't
+// part of its layer selection, such as its bonus or scatter sprites. The
+// salt gives every such draw its own stream, so turning one on or off
+// leaves the combinations and every other draw of the collection as they
+// were.
+func saltedRandomizer(salt int64, i int) Randomizer {
+	return newRandomizer(deriveSeed(*seed^salt, i))
+}
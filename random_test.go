@@ -0,0 +1,76 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// scriptedRandomizer returns its values in order, failing the test when a
+// selection draws more than were scripted.
+type scriptedRandomizer struct {
+	t      *testing.T
+	floats []float64
+}
+
+func (r *scriptedRandomizer) Float64() float64 {
+	if len(r.floats) == 0 {
+		r.t.Fatal("selection drew more values than scripted")
+	}
+	f := r.floats[0]
+	r.floats = r.floats[1:]
+	return f
+}
+
+func (r *scriptedRandomizer) Intn(n int) int {
+	return int(r.Float64() * float64(n))
+}
+
+func TestInjectedRandomizer(t *testing.T) {
+	tests := []struct {
+		name   string
+		script []float64
+		want   []string
+	}{
+		// Background a, b, c#2 and Hat x, y, absent with 0.5
+		{"first files", []float64{0, 0.9, 0}, []string{"a.png", "x.png"}},
+		{"weighted file", []float64{0.5, 0.9, 0.99}, []string{"c#2.png", "y.png"}},
+		{"middle file", []float64{0.3, 0.7, 0.4}, []string{"b.png", "x.png"}},
+		{"absent hat", []float64{0.99, 0.2}, []string{"c#2.png", noneTrait}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeLayers(t, filepath.Join(root, "Background"), "a.png", "b.png", "c#2.png")
+			writeLayers(t, filepath.Join(root, "Hat"), "x.png", "y.png")
+			dirs := []LayerDir{
+				{Key: "DIR1", Path: filepath.Join(root, "Background"), Pick: 1},
+				{Key: "DIR2", Path: filepath.Join(root, "Hat"), Pick: 1, Absence: 0.5},
+			}
+
+			seeds := []int64{}
+			old := newRandomizer
+			newRandomizer = func(seed int64) Randomizer {
+				seeds = append(seeds, seed)
+				return &scriptedRandomizer{t: t, floats: append([]float64{}, tt.script...)}
+			}
+			t.Cleanup(func() { newRandomizer = old })
+			setFlag(t, "seed", "5")
+
+			layers, err := selectToken(3, tokenRand(3), dirs, rerolls)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, layer := range layers {
+				got = append(got, layer.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selected %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(seeds, []int64{deriveSeed(5, 3)}) {
+				t.Errorf("randomizers made for seeds %v, want the one of token 3", seeds)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"sort"
+	"sync"
+)
+
+var attributeRarity = flag.Bool("attribute-rarity", false, "add the realized rarity percentage to each attribute (metadata is written after all images)")
+
+// tokenStore collects the metadata of every token written during a run for
+// the steps that need the whole collection.
+type tokenStore struct {
+	mu     sync.Mutex
+	metas  map[int]Metadata
+	layers map[int][]Layer
+}
+
+func newTokenStore() *tokenStore {
+	return &tokenStore{metas: map[int]Metadata{}, layers: map[int][]Layer{}}
+}
+
+func (s *tokenStore) add(i int, meta Metadata, layers []Layer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metas[i] = meta
+	s.layers[i] = layers
+}
+
+// indexes returns the stored token indexes in ascending order.
+func (s *tokenStore) indexes() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	indexes := make([]int, 0, len(s.metas))
+	for i := range s.metas {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// traitCounts returns how many tokens carry each trait_type and value.
+func traitCounts(metas map[int]Metadata) map[string]map[string]int {
+	counts := map[string]map[string]int{}
+	for _, meta := range metas {
+		for _, attr := range meta.Attributes {
+			if counts[attr.TraitType] == nil {
+				counts[attr.TraitType] = map[string]int{}
+			}
+			counts[attr.TraitType][attr.Value]++
+		}
+	}
+	return counts
+}
+
+// addAttributeRarity sets the rarity of every attribute to the percentage
+// of tokens sharing its value, rounded to two decimals.
+func addAttributeRarity(s *tokenStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := traitCounts(s.metas)
+	total := float64(len(s.metas))
+
+	for i, meta := range s.metas {
+		attrs := make([]Attribute, len(meta.Attributes))
+		for a, attr := range meta.Attributes {
+			rarity := math.Round(float64(counts[attr.TraitType][attr.Value])/total*10000) / 100
+			attr.Rarity = &rarity
+			attrs[a] = attr
+		}
+		meta.Attributes = attrs
+		s.metas[i] = meta
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestAttributeRarity(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+		env   []string
+		chunk int
+	}{
+		{"every trait present", 12, nil, 0},
+		{"None counts as a value", 15, []string{"DIR2_ABSENCE=0.4"}, 0},
+		{"chunked output", 7, nil, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "red#4.png", "blue#2.png", "green.png")
+			writeLayers(t, filepath.Join(work, "2 Hat"), "cap.png", "crown#0.3.png", "beanie.png")
+			writeLayers(t, filepath.Join(work, "3 Eyes"), "round.png", "sleepy.png")
+			env := append([]string{"DIR1=1 Background", "DIR2=2 Hat", "DIR3=3 Eyes", "OUTPUT_DIR=out", "NFT_COUNT=" + strconv.Itoa(tt.count)}, tt.env...)
+			mustRunMixer(t, work, env, "-seed", "17", "-attribute-rarity", "-chunk-size", strconv.Itoa(tt.chunk))
+
+			metas := map[int]Metadata{}
+			for i := 1; i <= tt.count; i++ {
+				var meta Metadata
+				dir := filepath.Join(work, "out")
+				if tt.chunk > 0 {
+					dir = filepath.Join(dir, fmt.Sprintf("batch_%04d", (i-1)/tt.chunk+1))
+				}
+				readJSON(t, filepath.Join(dir, strconv.Itoa(i)+".json"), &meta)
+				metas[i] = meta
+			}
+
+			// Realized frequencies from the written files
+			counts := map[[2]string]int{}
+			for _, meta := range metas {
+				for _, attr := range meta.Attributes {
+					counts[[2]string{attr.TraitType, attr.Value}]++
+				}
+			}
+			for i, meta := range metas {
+				for _, attr := range meta.Attributes {
+					want := math.Round(float64(counts[[2]string{attr.TraitType, attr.Value}])/float64(tt.count)*10000) / 100
+					if attr.Rarity == nil || *attr.Rarity != want {
+						t.Errorf("token %d %s %s has rarity %v, want %v", i, attr.TraitType, attr.Value, attr.Rarity, want)
+					}
+				}
+			}
+		})
+	}
+}
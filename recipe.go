@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var fromRecipe = flag.String("from-recipe", "", "reproduce the collection described by a recipe.json, checking that the config and layer files still match")
+
+// selectionVersion changes whenever the selection draws randomness
+// differently, which makes the same seed produce a different collection.
+const selectionVersion = 2
+
+// Recipe is written to recipe.json and holds what's needed to reproduce a
+// collection from the same layer files.
+type Recipe struct {
+	SelectionVersion int    `json:"selection_version"`
+	Seed             int64  `json:"seed"`
+	ConfigHash       string `json:"config_hash"`
+	// Flags are the command line flags the run was started with.
+	Flags map[string]string `json:"flags,omitempty"`
+	// Assets maps trait_type/file paths to their sha256.
+	Assets map[string]string `json:"assets"`
+	// Reshuffled lists the tokens given a new combination by -reshuffle.
+	Reshuffled []int `json:"reshuffled,omitempty"`
+}
+
+// unhashedConfig lists the settings that don't change the generated files
+// or are recorded separately, so they are left out of the config hash.
+var unhashedConfig = map[string]bool{
+	"seed": true, "from-recipe": true, "dump-config": true, "max-worker-panics": true, "resume": true, "golden-check": true,
+	"reshuffle": true, "nonce": true,
+	"OUTPUT_DIR": true, "IMAGE_WORKERS": true, "META_WORKERS": true, "path": true,
+}
+
+// getConfigHash hashes the -dump-config output without the source comments
+// and the settings in unhashedConfig.
+func getConfigHash(dirs []LayerDir, outputDir string) string {
+	var config bytes.Buffer
+	writeConfig(&config, dirs, outputDir)
+
+	hash := sha256.New()
+	scanner := bufio.NewScanner(&config)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.LastIndex(line, " # "); i >= 0 {
+			line = line[:i]
+		}
+		key := strings.TrimPrefix(strings.TrimSpace(line), "- ")
+		if i := strings.Index(key, ":"); i >= 0 && unhashedConfig[key[:i]] {
+			continue
+		}
+		fmt.Fprintln(hash, line)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// getAssetChecksums returns the sha256 of every layer file and of the
+// -bonus-layer, keyed by a path independent of where the layers live.
+func getAssetChecksums(dirs []LayerDir) (map[string]string, error) {
+	checksums := map[string]string{}
+	for _, dir := range dirs {
+		assets, err := listAssets([]LayerDir{dir})
+		if err != nil {
+			return nil, err
+		}
+		for _, asset := range assets {
+			data, err := layerSource.ReadFile(asset)
+			if err != nil {
+				return nil, err
+			}
+			rel, err := filepath.Rel(dir.Path, asset)
+			if err != nil {
+				return nil, err
+			}
+			sum := sha256.Sum256(data)
+			checksums[getTraitType(dir)+"/"+filepath.ToSlash(rel)] = hex.EncodeToString(sum[:])
+		}
+	}
+
+	if *bonusLayer != "" {
+		data, err := layerSource.ReadFile(*bonusLayer)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(data)
+		checksums[*bonusTrait+"/"+filepath.Base(*bonusLayer)] = hex.EncodeToString(sum[:])
+	}
+	return checksums, nil
+}
+
+// saveRecipe writes the recipe.json of the run, reshuffled lists the
+// reshuffled tokens of the collection.
+func saveRecipe(dirs []LayerDir, outputDir string, reshuffled []int) error {
+	assets, err := getAssetChecksums(dirs)
+	if err != nil {
+		return err
+	}
+	recipe := Recipe{
+		SelectionVersion: selectionVersion,
+		Seed:             *seed,
+		ConfigHash:       getConfigHash(dirs, outputDir),
+		Flags:            map[string]string{},
+		Assets:           assets,
+		Reshuffled:       reshuffled,
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if !unhashedConfig[f.Name] {
+			recipe.Flags[f.Name] = f.Value.String()
+		}
+	})
+
+	data, err := encodeJSON(recipe)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outputDir, "recipe.json"), data, 0644)
+}
+
+// applyRecipe reads -from-recipe and takes over its seed and the flags
+// that weren't given on the command line.
+func applyRecipe() (Recipe, error) {
+	var recipe Recipe
+	data, err := os.ReadFile(*fromRecipe)
+	if err != nil {
+		return recipe, err
+	}
+	err = json.Unmarshal(data, &recipe)
+	if err != nil {
+		return recipe, fmt.Errorf("invalid recipe '%s': %v", *fromRecipe, err)
+	}
+	if recipe.SelectionVersion != selectionVersion {
+		return recipe, fmt.Errorf("recipe '%s' was made with selection version %d, this build uses %d and can't reproduce it", *fromRecipe, recipe.SelectionVersion, selectionVersion)
+	}
+	// A reshuffled token avoided the tokens generated after it, which a
+	// run from the start can't know about
+	if len(recipe.Reshuffled) > 0 {
+		return recipe, fmt.Errorf("recipe '%s' is of a collection with reshuffled tokens %v, which can't be generated again from a recipe", *fromRecipe, recipe.Reshuffled)
+	}
+
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for name, value := range recipe.Flags {
+		if set[name] {
+			continue
+		}
+		err := flag.Set(name, value)
+		if err != nil {
+			return recipe, fmt.Errorf("recipe flag -%s: %v", name, err)
+		}
+	}
+	*seed = recipe.Seed
+	return recipe, nil
+}
+
+// checkRecipe fails when the configuration or any layer file differs from
+// the one the recipe was made with.
+func checkRecipe(recipe Recipe, dirs []LayerDir, outputDir string) error {
+	var problems []string
+	if hash := getConfigHash(dirs, outputDir); hash != recipe.ConfigHash {
+		problems = append(problems, "the configuration differs (compare the .env and flags with -dump-config)")
+	}
+
+	assets, err := getAssetChecksums(dirs)
+	if err != nil {
+		return err
+	}
+	for path, sum := range recipe.Assets {
+		switch current, ok := assets[path]; {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("'%s' is missing", path))
+		case current != sum:
+			problems = append(problems, fmt.Sprintf("'%s' has changed", path))
+		}
+	}
+	for path := range assets {
+		if _, ok := recipe.Assets[path]; !ok {
+			problems = append(problems, fmt.Sprintf("'%s' was added", path))
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return errors.New("the recipe can't be reproduced:\n  " + strings.Join(problems, "\n  "))
+}
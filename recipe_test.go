@@ -0,0 +1,102 @@
+package main
+
+import (
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// recipeFixture writes a two trait collection into a new directory and
+// returns it with the environment naming it.
+func recipeFixture(t *testing.T) (string, []string) {
+	t.Helper()
+	work := t.TempDir()
+	writeLayers(t, filepath.Join(work, "1 Background"), "dawn.png", "dusk#2.png", "noon.png")
+	writeLayers(t, filepath.Join(work, "2 Bird"), "crow.png", "gull.png", "wren#0.5.png")
+	return work, []string{"DIR1=1 Background", "DIR2=2 Bird", "DIR2_ABSENCE=0.2", "NFT_COUNT=7", "OUTPUT_DIR=out"}
+}
+
+func TestFromRecipe(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"seed only", nil},
+		{"with output flags", []string{"-chunk-size", "3", "-mask", "circle"}},
+		{"with selection flags", []string{"-min-traits", "2", "-enumerate-above", "0.01"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work, env := recipeFixture(t)
+			mustRunMixer(t, work, env, append([]string{"-seed", "31"}, tt.args...)...)
+			out := filepath.Join(work, "out")
+			want := mustReadTree(t, out)
+
+			if err := os.Rename(filepath.Join(out, "recipe.json"), filepath.Join(work, "recipe.json")); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.RemoveAll(out); err != nil {
+				t.Fatal(err)
+			}
+			// The recipe brings back the seed and the flags
+			mustRunMixer(t, work, env, "-from-recipe", "recipe.json")
+			diffTrees(t, mustReadTree(t, out), want)
+		})
+	}
+}
+
+func TestFromRecipeMismatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, work string) []string
+		want   string
+	}{
+		{"changed file", func(t *testing.T, work string) []string {
+			writePNG(t, filepath.Join(work, "2 Bird", "gull.png"), solid(4, 4, color.NRGBA{1, 2, 3, 255}))
+			return nil
+		}, "'Bird/gull.png' has changed"},
+		{"removed file", func(t *testing.T, work string) []string {
+			os.Remove(filepath.Join(work, "1 Background", "noon.png"))
+			return nil
+		}, "'Background/noon.png' is missing"},
+		{"added file", func(t *testing.T, work string) []string {
+			writePNG(t, filepath.Join(work, "2 Bird", "owl.png"), solid(4, 4, color.White))
+			return nil
+		}, "'Bird/owl.png' was added"},
+		{"changed configuration", func(t *testing.T, work string) []string {
+			return []string{"DIR2_ABSENCE=0.5"}
+		}, "the configuration differs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work, env := recipeFixture(t)
+			mustRunMixer(t, work, env, "-seed", "31")
+			if err := os.Rename(filepath.Join(work, "out", "recipe.json"), filepath.Join(work, "recipe.json")); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.RemoveAll(filepath.Join(work, "out")); err != nil {
+				t.Fatal(err)
+			}
+
+			extra := tt.change(t, work)
+			out, err := runMixer(t, work, append(env, extra...), "-from-recipe", "recipe.json")
+			if err == nil || !strings.Contains(out, "the recipe can't be reproduced") || !strings.Contains(out, tt.want) {
+				t.Fatalf("got %v, want a failure saying %q:\n%s", err, tt.want, out)
+			}
+			if _, err := os.Stat(filepath.Join(work, "out")); !os.IsNotExist(err) {
+				t.Error("the output directory was created")
+			}
+		})
+	}
+}
+
+func TestRecipeSelectionVersion(t *testing.T) {
+	work, env := recipeFixture(t)
+	writeFile(t, filepath.Join(work, "recipe.json"), `{"selection_version": 1, "seed": 31, "assets": {}}`)
+	out, err := runMixer(t, work, env, "-from-recipe", "recipe.json")
+	if err == nil || !strings.Contains(out, "selection version 1, this build uses 2") {
+		t.Fatalf("got %v, want the old recipe refused:\n%s", err, out)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// rerollCounts records how many selections each rule rejected, showing
+// which constraint makes generation slow.
+type rerollCounts struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+var rerolls = &rerollCounts{counts: map[string]int{}}
+
+func (r *rerollCounts) add(rule string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[rule]++
+}
+
+// report prints the re-rolls per rule, most expensive first.
+func (r *rerollCounts) report(selections int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.counts) == 0 {
+		return
+	}
+
+	rules := make([]string, 0, len(r.counts))
+	total := 0
+	for rule, n := range r.counts {
+		rules = append(rules, rule)
+		total += n
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if r.counts[rules[i]] != r.counts[rules[j]] {
+			return r.counts[rules[i]] > r.counts[rules[j]]
+		}
+		return rules[i] < rules[j]
+	})
+
+	fmt.Printf("Re-rolls: %d wasted selections for %d NFTs\n", total, selections)
+	for _, rule := range rules {
+		fmt.Printf("  %-12s %d\n", rule, r.counts[rule])
+	}
+}
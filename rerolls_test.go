@@ -0,0 +1,106 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// reportedRerolls parses the re-roll lines of a run's report.
+func reportedRerolls(t *testing.T, out string) (map[string]int, []string) {
+	t.Helper()
+	counts := map[string]int{}
+	var order []string
+	for _, m := range regexp.MustCompile(`(?m)^  (\S+) +(\d+)$`).FindAllStringSubmatch(out, -1) {
+		n, _ := strconv.Atoi(m[2])
+		counts[m[1]] = n
+		order = append(order, m[1])
+	}
+	return counts, order
+}
+
+func TestRerollsPerRule(t *testing.T) {
+	tests := []struct {
+		name string
+		env  []string
+		args []string
+		// costliest is the rule expected to cause the most re-rolls, none
+		// of the rules outside rules may cause any
+		costliest string
+		rules     []string
+	}{
+		{"min-traits only",
+			[]string{"DIR1_ABSENCE=0.6", "DIR2_ABSENCE=0.6", "DIR3_ABSENCE=0.6"},
+			[]string{"-min-traits", "3"}, "min-traits", []string{"min-traits"}},
+		{"no-adjacent only",
+			nil,
+			[]string{"-no-adjacent", "Background"}, "no-adjacent", []string{"no-adjacent", "duplicate"}},
+		{"strict min-traits, lax no-adjacent",
+			[]string{"DIR1_ABSENCE=0.6", "DIR2_ABSENCE=0.6", "DIR3_ABSENCE=0.6"},
+			[]string{"-min-traits", "3", "-no-adjacent", "Hat"}, "min-traits", []string{"min-traits", "no-adjacent", "duplicate"}},
+		{"strict no-adjacent, lax min-traits",
+			[]string{"DIR3_ABSENCE=0.2"},
+			[]string{"-min-traits", "3", "-no-adjacent", "Background"}, "no-adjacent", []string{"min-traits", "no-adjacent", "duplicate"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "blue.png", "red.png")
+			writeLayers(t, filepath.Join(work, "2 Body"), "a.png", "b.png", "c.png", "d.png", "e.png", "f.png")
+			writeLayers(t, filepath.Join(work, "3 Hat"), "cap.png", "crown.png", "fez.png", "beret.png", "helmet.png", "hood.png")
+			env := append([]string{"DIR1=1 Background", "DIR2=2 Body", "DIR3=3 Hat", "NFT_COUNT=12", "OUTPUT_DIR=out"}, tt.env...)
+			out := mustRunMixer(t, work, env, append([]string{"-seed", "13", "-enumerate-above", "0"}, tt.args...)...)
+
+			counts, order := reportedRerolls(t, out)
+			if len(order) == 0 || order[0] != tt.costliest || counts[tt.costliest] == 0 {
+				t.Fatalf("re-rolls %v, want %s the costliest:\n%s", counts, tt.costliest, out)
+			}
+			for rule, n := range counts {
+				allowed := false
+				for _, r := range tt.rules {
+					allowed = allowed || r == rule
+				}
+				if !allowed {
+					t.Errorf("%s caused %d re-rolls without being enabled", rule, n)
+				}
+			}
+		})
+	}
+}
+
+func TestMinTraitsRerollCount(t *testing.T) {
+	root := t.TempDir()
+	var dirs []LayerDir
+	for n, trait := range []string{"Hat", "Scarf", "Badge"} {
+		writeLayers(t, filepath.Join(root, trait), "a.png", "b.png")
+		dirs = append(dirs, LayerDir{Key: "DIR" + strconv.Itoa(n+1), Path: filepath.Join(root, trait), Pick: 1, Absence: 0.5})
+	}
+	setFlag(t, "seed", "8")
+	setFlag(t, "min-traits", "2")
+	old := rerolls
+	rerolls = &rerollCounts{counts: map[string]int{}}
+	t.Cleanup(func() { rerolls = old })
+
+	// Replay the draws to count the ones with fewer than 2 traits
+	want := 0
+	for i := 1; i <= 50; i++ {
+		rng := tokenRand(i)
+		for {
+			layers, err := selectRandomLayers(rng, dirs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if countPresent(layers) >= 2 {
+				break
+			}
+			want++
+		}
+		if _, err := selectToken(i, tokenRand(i), dirs, rerolls); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want == 0 || rerolls.counts["min-traits"] != want || len(rerolls.counts) != 1 {
+		t.Errorf("counted %v, want %d min-traits re-rolls", rerolls.counts, want)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var reshuffle = flag.String("reshuffle", "", "comma separated token indexes of the run in OUTPUT_DIR to give a new combination, keeping every other token (implies -resume)")
+var nonce = flag.Int("nonce", 1, "per-index nonce of -reshuffle, raise it to draw yet another combination for the same indexes")
+
+// reshuffled holds the -reshuffle indexes.
+var reshuffled map[int]bool
+
+// parseReshuffle reads the -reshuffle indexes, which must be tokens of a
+// collection of nftCount.
+func parseReshuffle(nftCount int) error {
+	if *reshuffle == "" {
+		return nil
+	}
+	if *nonce < 1 {
+		return fmt.Errorf("invalid -nonce %d, it must be at least 1", *nonce)
+	}
+
+	reshuffled = map[int]bool{}
+	for _, field := range strings.Split(*reshuffle, ",") {
+		i, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || i < 1 || i > nftCount {
+			return fmt.Errorf("invalid -reshuffle index '%s', expected a token from 1 to %d", field, nftCount)
+		}
+		reshuffled[i] = true
+	}
+	return nil
+}
+
+// originalDraw returns the combination token i draws when it isn't
+// reshuffled, without counting its re-rolls.
+func originalDraw(i int, dirs []LayerDir) ([]Layer, error) {
+	return selectToken(i, newRandomizer(deriveSeed(*seed, i)), dirs, nil)
+}
+
+// reshuffleSeed returns the seed token i draws from when it's reshuffled,
+// derived from its usual seed and the nonce so every nonce gives the index
+// its own reproducible stream.
+func reshuffleSeed(i int) int64 {
+	return deriveSeed(deriveSeed(*seed, i), *nonce)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReshuffle(t *testing.T) {
+	few := []string{"dawn.png", "dusk.png"}
+	many := []string{"dawn.png", "dusk.png", "noon.png", "night.png"}
+	birds := []string{"crow.png", "gull.png", "wren.png", "owl.png", "kite.png"}
+	var everySeed []int
+	for seed := 1; seed <= 12; seed++ {
+		everySeed = append(everySeed, seed)
+	}
+	tests := []reshuffleCase{
+		{"two tokens", many, birds, 8, []int{2, 5}, "2", []int{3}},
+		{"first token", many, birds, 8, []int{1}, "1", []int{3}},
+		{"last tokens", many, birds, 8, []int{7, 8}, "3", []int{3}},
+		// Most combinations are taken, so the collection was drawn by the
+		// enumerating sampler, whose tokens aren't their first draw
+		{"enumerated collection", few, birds[:3], 4, []int{2}, "1", everySeed},
+		{"enumerated collection, two tokens", few, birds, 6, []int{1, 3}, "2", everySeed},
+	}
+	for _, tt := range tests {
+		for _, seed := range tt.seeds {
+			t.Run(fmt.Sprintf("%s/seed %d", tt.name, seed), func(t *testing.T) {
+				testReshuffle(t, tt, seed)
+			})
+		}
+	}
+}
+
+type reshuffleCase struct {
+	name        string
+	backgrounds []string
+	birds       []string
+	nftCount    int
+	indexes     []int
+	nonce       string
+	seeds       []int
+}
+
+// testReshuffle reshuffles a collection of tt generated with seed and
+// checks the reshuffled tokens.
+func testReshuffle(t *testing.T, tt reshuffleCase, seed int) {
+	work := t.TempDir()
+	writeLayers(t, filepath.Join(work, "1 Background"), tt.backgrounds...)
+	writeLayers(t, filepath.Join(work, "2 Bird"), tt.birds...)
+	env := []string{"DIR1=1 Background", "DIR2=2 Bird", fmt.Sprint("NFT_COUNT=", tt.nftCount)}
+	mustRunMixer(t, work, append(env, "OUTPUT_DIR=out"), "-seed", strconv.Itoa(seed))
+	before := mustReadTree(t, filepath.Join(work, "out"))
+	for name, data := range before {
+		writeFile(t, filepath.Join(work, "copy", name), string(data))
+	}
+
+	var fields []string
+	for _, i := range tt.indexes {
+		fields = append(fields, strconv.Itoa(i))
+	}
+	args := []string{"-reshuffle", strings.Join(fields, ","), "-nonce", tt.nonce}
+	mustRunMixer(t, work, append(env, "OUTPUT_DIR=out"), args...)
+	after := mustReadTree(t, filepath.Join(work, "out"))
+
+	combinations := func(dir string) map[int]string {
+		var manifest Manifest
+		readJSON(t, filepath.Join(work, dir, "manifest.json"), &manifest)
+		combos := map[int]string{}
+		for _, token := range manifest.Tokens {
+			var paths []string
+			for _, layer := range token.Layers {
+				paths = append(paths, layer.Path)
+			}
+			combos[token.Index] = strings.Join(paths, "+")
+		}
+		return combos
+	}
+	oldCombos, combos := combinations("copy"), combinations("out")
+
+	taken := map[string]int{}
+	for i := 1; i <= tt.nftCount; i++ {
+		if other, ok := taken[combos[i]]; ok {
+			t.Errorf("tokens %d and %d are both %s", other, i, combos[i])
+		}
+		taken[combos[i]] = i
+
+		changed := combos[i] != oldCombos[i]
+		if changed != slices.Contains(tt.indexes, i) {
+			t.Errorf("token %d: combination changed %v, %s -> %s", i, changed, oldCombos[i], combos[i])
+		}
+		// Every other token keeps its files
+		for _, name := range []string{strconv.Itoa(i) + ".png", strconv.Itoa(i) + ".json"} {
+			if !changed && !bytes.Equal(after[name], before[name]) {
+				t.Errorf("%s of a kept token changed", name)
+			}
+		}
+	}
+
+	// The same nonce reshuffles the same way again, on the
+	// reshuffled collection or on a copy of the original one
+	mustRunMixer(t, work, append(env, "OUTPUT_DIR=out"), args...)
+	diffTrees(t, mustReadTree(t, filepath.Join(work, "out")), after)
+	mustRunMixer(t, work, append(env, "OUTPUT_DIR=copy"), args...)
+	diffTrees(t, mustReadTree(t, filepath.Join(work, "copy")), after)
+
+	// The recipe records the reshuffle instead of replaying it
+	var recipe Recipe
+	readJSON(t, filepath.Join(work, "out", "recipe.json"), &recipe)
+	if !slices.Equal(recipe.Reshuffled, tt.indexes) {
+		t.Errorf("recipe lists reshuffled tokens %v, want %v", recipe.Reshuffled, tt.indexes)
+	}
+	for _, flag := range []string{"reshuffle", "nonce"} {
+		if _, ok := recipe.Flags[flag]; ok {
+			t.Errorf("recipe flags have -%s", flag)
+		}
+	}
+	for _, mode := range [][]string{{"-from-recipe", filepath.Join("out", "recipe.json")}, {"-golden-check", "out"}} {
+		out, err := runMixer(t, work, append(env, "OUTPUT_DIR=again"), mode...)
+		if err == nil {
+			t.Errorf("%s of a reshuffled collection succeeded:\n%s", mode[0], out)
+		} else if !strings.Contains(out, "is of a collection with reshuffled tokens") {
+			t.Errorf("%s doesn't refuse the reshuffled recipe:\n%s", mode[0], out)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(work, "again")); !os.IsNotExist(err) {
+		t.Error("a refused recipe created the output directory")
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
+)
+
+// resizeImage scales img to w x h with bilinear filtering. Interpolation
+// happens on premultiplied colors so transparent pixels don't bleed.
+func resizeImage(img image.Image, w, h int) *image.RGBA {
+	src, ok := img.(*image.RGBA)
+	if !ok {
+		src = image.NewRGBA(img.Bounds())
+		draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+	}
+	bounds := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	if w == 0 || h == 0 || bounds.Empty() {
+		return dst
+	}
+
+	scaleX := float64(bounds.Dx()) / float64(w)
+	scaleY := float64(bounds.Dy()) / float64(h)
+
+	for y := 0; y < h; y++ {
+		sy := (float64(y)+0.5)*scaleY - 0.5
+		y0 := int(math.Floor(sy))
+		fy := sy - float64(y0)
+		y0, y1 := clampInt(y0, 0, bounds.Dy()-1), clampInt(y0+1, 0, bounds.Dy()-1)
+
+		for x := 0; x < w; x++ {
+			sx := (float64(x)+0.5)*scaleX - 0.5
+			x0 := int(math.Floor(sx))
+			fx := sx - float64(x0)
+			x0, x1 := clampInt(x0, 0, bounds.Dx()-1), clampInt(x0+1, 0, bounds.Dx()-1)
+
+			p00 := src.PixOffset(bounds.Min.X+x0, bounds.Min.Y+y0)
+			p10 := src.PixOffset(bounds.Min.X+x1, bounds.Min.Y+y0)
+			p01 := src.PixOffset(bounds.Min.X+x0, bounds.Min.Y+y1)
+			p11 := src.PixOffset(bounds.Min.X+x1, bounds.Min.Y+y1)
+			d := dst.PixOffset(x, y)
+
+			for c := 0; c < 4; c++ {
+				top := float64(src.Pix[p00+c])*(1-fx) + float64(src.Pix[p10+c])*fx
+				bottom := float64(src.Pix[p01+c])*(1-fx) + float64(src.Pix[p11+c])*fx
+				dst.Pix[d+c] = uint8(math.Round(top*(1-fy) + bottom*fy))
+			}
+		}
+	}
+
+	return dst
+}
+
+// scaleLongestSide returns the size of bounds scaled so its longest side
+// is n, keeping the aspect ratio.
+func scaleLongestSide(bounds image.Rectangle, n int) (int, int) {
+	if bounds.Dx() > bounds.Dy() {
+		return n, (bounds.Dy()*n + bounds.Dx()/2) / bounds.Dx()
+	}
+	return (bounds.Dx()*n + bounds.Dy()/2) / bounds.Dy(), n
+}
+
+func clampInt(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// getTargetResolution parses TARGET_RESOLUTION (e.g. 1000x1000). It returns
+// false when every layer should keep its own size.
+func getTargetResolution() (image.Point, bool) {
+	value := os.Getenv("TARGET_RESOLUTION")
+	if value == "" {
+		return image.Point{}, false
+	}
+
+	var w, h int
+	_, err := fmt.Sscanf(strings.ToLower(value), "%dx%d", &w, &h)
+	if err != nil || w < 1 || h < 1 {
+		log.Fatalf("Invalid TARGET_RESOLUTION value '%s', expected WIDTHxHEIGHT", value)
+	}
+	return image.Pt(w, h), true
+}
+
+// fitToResolution scales img uniformly to fit inside size and centers it on
+// a transparent canvas of exactly that size, so layers authored at
+// different resolutions line up.
+func fitToResolution(img image.Image, size image.Point) image.Image {
+	bounds := img.Bounds()
+	if bounds.Size() == size {
+		return img
+	}
+
+	scale := math.Min(float64(size.X)/float64(bounds.Dx()), float64(size.Y)/float64(bounds.Dy()))
+	w := int(math.Round(float64(bounds.Dx()) * scale))
+	h := int(math.Round(float64(bounds.Dy()) * scale))
+	scaled := resizeImage(img, w, h)
+
+	canvas := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+	offset := image.Pt((size.X-w)/2, (size.Y-h)/2)
+	draw.Draw(canvas, scaled.Bounds().Add(offset), scaled, image.Point{}, draw.Src)
+	return canvas
+}
+
+// scaledLayers holds the scaled images of unshifted layer files keyed by
+// path, pipeline and size, so tokens sharing a file scale it once.
+var scaledLayers = struct {
+	sync.Mutex
+	images map[string]image.Image
+}{images: map[string]image.Image{}}
+
+// loadScaledLayer returns the image of layer fitted to size, reusing the
+// one of an earlier call for the same file and size. The color shift of
+// layer is not applied.
+func loadScaledLayer(layer Layer, size image.Point) (image.Image, error) {
+	key := fmt.Sprintf("%s|%s|%dx%d", layer.Path, layer.Preprocess, size.X, size.Y)
+	scaledLayers.Lock()
+	img, ok := scaledLayers.images[key]
+	scaledLayers.Unlock()
+	if ok {
+		return img, nil
+	}
+
+	img, err := loadLayerImage(layer)
+	if err != nil {
+		return nil, err
+	}
+	img = fitToResolution(img, size)
+
+	scaledLayers.Lock()
+	scaledLayers.images[key] = img
+	scaledLayers.Unlock()
+	return img, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTargetResolution(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		size   image.Point
+		// covered is the part of the canvas the scaled asset covers
+		covered image.Rectangle
+	}{
+		{"smaller asset scaled up", "12x12", image.Pt(6, 6), image.Rect(0, 0, 12, 12)},
+		{"larger asset scaled down", "12x12", image.Pt(24, 24), image.Rect(0, 0, 12, 12)},
+		{"same size kept", "12x12", image.Pt(12, 12), image.Rect(0, 0, 12, 12)},
+		{"wide asset letterboxed", "12x12", image.Pt(24, 12), image.Rect(0, 3, 12, 9)},
+		{"tall asset pillarboxed", "12x12", image.Pt(4, 8), image.Rect(3, 0, 9, 12)},
+		{"non-square target", "20x10", image.Pt(8, 8), image.Rect(5, 0, 15, 10)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TARGET_RESOLUTION", tt.target)
+			target, _ := getTargetResolution()
+			root := t.TempDir()
+
+			// A full-size background authored at another resolution than
+			// the asset
+			background := solid(target.X*2, target.Y*2, color.NRGBA{0, 0, 255, 255})
+			writePNG(t, filepath.Join(root, "Background", "blue.png"), background)
+			writePNG(t, filepath.Join(root, "Hat", "red.png"), solid(tt.size.X, tt.size.Y, color.NRGBA{255, 0, 0, 255}))
+
+			layers := []Layer{
+				{Name: "blue.png", Trait: "Background", Path: filepath.Join(root, "Background", "blue.png")},
+				{Name: "red.png", Trait: "Hat", Path: filepath.Join(root, "Hat", "red.png")},
+			}
+			if err := loadLayers(layers); err != nil {
+				t.Fatal(err)
+			}
+			for _, layer := range layers {
+				if got := layer.Image.Bounds(); got != image.Rect(0, 0, target.X, target.Y) {
+					t.Fatalf("%s is %v, want %v", layer.Name, got, target)
+				}
+			}
+
+			img := combineLayers(layers)
+			for y := 0; y < target.Y; y++ {
+				for x := 0; x < target.X; x++ {
+					c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+					want := color.NRGBA{0, 0, 255, 255}
+					if image.Pt(x, y).In(tt.covered) {
+						want = color.NRGBA{255, 0, 0, 255}
+					}
+					if c != want {
+						t.Fatalf("pixel %d,%d is %v, want %v", x, y, c, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestScaledLayerCache(t *testing.T) {
+	tests := []struct {
+		name       string
+		preprocess Pipeline
+		shift      *ColorShift
+		// shared is whether tokens using the file get the same image
+		shared bool
+	}{
+		{"plain file", nil, nil, true},
+		{"preprocessed", Pipeline{{Op: "outline", Size: 1, Color: color.NRGBA{0, 0, 0, 255}}}, nil, true},
+		{"color shifted", nil, &ColorShift{TraitType: "Hat", Hue: 40, Saturation: -0.2}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TARGET_RESOLUTION", "20x20")
+			path := filepath.Join(t.TempDir(), "Hat", "gradient.png")
+			src := image.NewNRGBA(image.Rect(0, 0, 10, 14))
+			for y := 0; y < 14; y++ {
+				for x := 2; x < 8; x++ {
+					src.SetNRGBA(x, y, color.NRGBA{uint8(25 * x), uint8(18 * y), 90, uint8(120 + 9*y)})
+				}
+			}
+			writePNG(t, path, src)
+			layer := Layer{Name: "gradient.png", Trait: "Hat", Path: path, Preprocess: tt.preprocess, Shift: tt.shift}
+
+			first, second := []Layer{layer}, []Layer{layer}
+			if err := loadLayers(first); err != nil {
+				t.Fatal(err)
+			}
+			if err := loadLayers(second); err != nil {
+				t.Fatal(err)
+			}
+			if shared := first[0].Image == second[0].Image; shared != tt.shared {
+				t.Errorf("tokens share the image %t, want %t", shared, tt.shared)
+			}
+
+			// The shift is applied before scaling, as without the cache
+			fresh, err := loadLayerImage(layer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.shift != nil {
+				fresh = shiftHSV(fresh, tt.shift.Hue, tt.shift.Saturation, tt.shift.Value)
+			}
+			fresh = fitToResolution(fresh, image.Pt(20, 20))
+			for _, token := range [][]Layer{first, second} {
+				got := token[0].Image
+				if got.Bounds() != fresh.Bounds() {
+					t.Fatalf("loaded %v, fresh %v", got.Bounds(), fresh.Bounds())
+				}
+				for y := fresh.Bounds().Min.Y; y < fresh.Bounds().Max.Y; y++ {
+					for x := fresh.Bounds().Min.X; x < fresh.Bounds().Max.X; x++ {
+						if c, f := got.At(x, y), fresh.At(x, y); c != f {
+							t.Fatalf("pixel %d,%d is %v loaded, %v fresh", x, y, c, f)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkScaledLayers loads one asset for the 20 tokens of a run using
+// it, with and without the cache.
+func BenchmarkScaledLayers(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "background.png")
+	f, err := os.Create(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	png.Encode(f, solid(512, 512, color.NRGBA{30, 60, 90, 255}))
+	f.Close()
+	layer := Layer{Name: "background.png", Trait: "Background", Path: path}
+	size := image.Pt(256, 256)
+
+	for _, cached := range []bool{true, false} {
+		name := "cached"
+		if !cached {
+			name = "rescaled"
+		}
+		b.Run(name, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				for token := 0; token < 20; token++ {
+					if !cached {
+						scaledLayers.Lock()
+						clear(scaledLayers.images)
+						scaledLayers.Unlock()
+					}
+					if _, err := loadScaledLayer(layer, size); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
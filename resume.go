@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+)
+
+var resume = flag.Bool("resume", false, "continue the run whose manifest.json is in OUTPUT_DIR: tokens whose image matches its manifest checksum are kept, changed ones re-rendered and indexes up to NFT_COUNT added")
+
+// readTokenMetadata reads the metadata file of token i, or returns false if
+// it's missing or unreadable.
+func readTokenMetadata(outputDir string, i int) (Metadata, bool) {
+	var meta Metadata
+	data, err := os.ReadFile(filepath.Join(outputDir, getTokenPath(outputDir, i, fmt.Sprintf("%d.json", i))))
+	if err != nil {
+		return meta, false
+	}
+	return meta, json.Unmarshal(data, &meta) == nil
+}
+
+// withoutBonus returns layers without the -bonus-layer, which isn't part
+// of the combination checked for duplicates.
+func withoutBonus(layers []Layer) []Layer {
+	var combination []Layer
+	for _, layer := range layers {
+		if *bonusLayer == "" || layer.Trait != *bonusTrait || layer.Path != *bonusLayer {
+			combination = append(combination, layer)
+		}
+	}
+	return combination
+}
+
+// resumeTokens takes over the tokens of the manifest in outputDir. A token
+// whose image file still has its manifest checksum is kept without
+// decoding anything; any other one is rendered again from its manifest
+// layers. Kept tokens go into the new manifest. It returns the layers of
+// every token that needs no generating.
+func resumeTokens(dirs []LayerDir, outputDir string, cache LayerCache, usage map[string]int, tokens *tokenStore, manifestTokens *manifestWriter) (map[int][]Layer, error) {
+	if *nameBy == "hash" {
+		return nil, errors.New("-resume needs -name-by index, re-rendered hash named images would change their names")
+	}
+
+	manifest, err := readManifest(outputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	done := map[int][]Layer{}
+	rendered, redrawn := 0, 0
+	for _, token := range manifest.Tokens {
+		// A token already reshuffled with this nonce is kept, so running
+		// the same reshuffle again changes nothing
+		if reshuffled[token.Index] && token.Nonce == *nonce {
+			delete(reshuffled, token.Index)
+		}
+
+		// A reshuffled token is generated again. Its current combination
+		// and its original draw stay taken so neither can come back
+		if reshuffled[token.Index] {
+			original, err := originalDraw(token.Index, dirs)
+			if err != nil {
+				return nil, err
+			}
+			for _, key := range []string{getCacheKey(withoutBonus(token.Layers)), getCacheKey(original)} {
+				if _, ok := cache[key]; !ok {
+					cache[key] = nil
+				}
+			}
+			redrawn++
+			continue
+		}
+
+		checksum, err := getImageChecksum(outputDir, token.Index, token.Image)
+		valid := err == nil && token.Checksum != "" && checksum == token.Checksum
+
+		// Rebuilt metadata needs the decoded layers too, for the size of
+		// the composite
+		meta, ok := readTokenMetadata(outputDir, token.Index)
+		if !ok || !valid {
+			err := renderManifestToken(token, dirs)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		var img image.Image
+		if !valid {
+			img = renderToken(token.Index, token.Layers)
+			saveImageToFile(token.Index, img, outputDir)
+			rendered++
+
+			token.Checksum, err = getImageChecksum(outputDir, token.Index, token.Image)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if !ok || !valid {
+			meta = buildMetadata(token.Index, token.Layers)
+			meta.Image = token.Image
+			if !*attributeRarity {
+				saveMetadataToFile(token.Index, meta, outputDir)
+			}
+		}
+
+		for _, layer := range token.Layers {
+			usage[layer.Path]++
+		}
+		cache[getCacheKey(withoutBonus(token.Layers))] = img
+		tokens.add(token.Index, meta, token.Layers)
+		err = manifestTokens.add(token)
+		if err != nil {
+			return nil, err
+		}
+		done[token.Index] = withoutBonus(token.Layers)
+	}
+
+	fmt.Printf("Resumed %d tokens, %d of them re-rendered because their image was missing or changed\n", len(done), rendered)
+	if *reshuffle != "" {
+		fmt.Printf("Reshuffling %d tokens with nonce %d\n", redrawn, *nonce)
+	}
+	return done, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResumeRerendersOnlyChangedImages(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(path string) error
+	}{
+		{"overwritten", func(path string) error { return os.WriteFile(path, []byte("not a png"), 0644) }},
+		{"truncated", func(path string) error { return os.Truncate(path, 20) }},
+		{"deleted", os.Remove},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Body"), "round.png", "square.png", "tall.png")
+			writeLayers(t, filepath.Join(work, "2 Eyes"), "open.png", "shut.png")
+			env := []string{"DIR1=1 Body", "DIR2=2 Eyes", "NFT_COUNT=5", "OUTPUT_DIR=out"}
+			mustRunMixer(t, work, env, "-seed", "21")
+			out := filepath.Join(work, "out")
+			want := mustReadTree(t, out)
+
+			// Date every file back, a re-rendered one gets a new time
+			old := time.Now().Add(-time.Hour).Truncate(time.Second)
+			for name := range want {
+				if err := os.Chtimes(filepath.Join(out, name), old, old); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tt.corrupt(filepath.Join(out, "3.png")); err != nil {
+				t.Fatal(err)
+			}
+
+			got := mustRunMixer(t, work, env, "-resume")
+			if !strings.Contains(got, "Resumed 5 tokens, 1 of them re-rendered") {
+				t.Errorf("resume didn't re-render exactly one token:\n%s", got)
+			}
+			diffTrees(t, mustReadTree(t, out), want)
+			for name := range want {
+				info, err := os.Stat(filepath.Join(out, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				rewritten := !info.ModTime().Equal(old)
+				if strings.HasSuffix(name, ".png") && rewritten != (name == "3.png") {
+					t.Errorf("%s: rewritten %v", name, rewritten)
+				}
+			}
+		})
+	}
+}
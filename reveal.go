@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"os"
+	"path/filepath"
+)
+
+var revealAnim = flag.Int("reveal-anim", 0, "write a GIF of token INDEX being built up layer by layer instead of generating the collection")
+var revealDelay = flag.Int("reveal-delay", 50, "delay between reveal animation frames in 100ths of a second")
+
+// saveRevealAnimation writes reveal_<i>.gif with one frame per composited
+// layer of token i. Tokens 1 to i are selected again the way generation
+// selects them, so with the collection's -seed and NFT_COUNT the animation
+// ends on the generated token.
+func saveRevealAnimation(i int, dirs []LayerDir, outputDir string) error {
+	layers, err := replaySelection(i, dirs)
+	if err != nil {
+		return err
+	}
+
+	err = loadLayers(layers)
+	if err != nil {
+		return err
+	}
+
+	anim := &gif.GIF{}
+	for _, step := range compositeSteps(layers) {
+		frame := image.NewPaletted(step.Bounds(), palette.Plan9)
+		draw.FloydSteinberg.Draw(frame, step.Bounds(), step, image.Point{})
+
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, *revealDelay)
+	}
+
+	err = os.MkdirAll(outputDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	outFile, err := os.Create(filepath.Join(outputDir, fmt.Sprintf("reveal_%d.gif", i)))
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+
+	return gif.EncodeAll(outFile, anim)
+}
+
+// replaySelection returns the layers, with the bonus, generation selects for
+// token i. Earlier tokens take combinations and quota away from later ones,
+// so every token up to i is drawn.
+func replaySelection(i int, dirs []LayerDir) ([]Layer, error) {
+	nftCount, err := getNFTCount()
+	if err != nil {
+		return nil, err
+	}
+	if i < 1 || i > nftCount {
+		return nil, fmt.Errorf("-reveal-anim %d isn't a token of the %d in NFT_COUNT", i, nftCount)
+	}
+
+	usage := map[string]int{}
+	if *useQuotas {
+		quotas = newQuotaTracker(nftCount, usage)
+	}
+	sampler, err := newCombinationSampler(dirs, nftCount)
+	if err != nil {
+		return nil, err
+	}
+	taken := map[string]bool{}
+	selector := &tokenSelector{dirs: dirs, sampler: sampler, exists: func(key string) bool { return taken[key] }}
+
+	for token := 1; ; token++ {
+		layers, err := selector.next(token)
+		if err != nil {
+			return nil, err
+		}
+		taken[getCacheKey(layers)] = true
+		layers = addBonusLayer(token, layers)
+		if token == i {
+			return layers, nil
+		}
+		for _, layer := range layers {
+			usage[layer.Path]++
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestRevealAnimationFrames(t *testing.T) {
+	tests := []struct {
+		name   string
+		dirs   func(root string) []LayerDir
+		frames int
+	}{
+		{"one layer per directory", func(root string) []LayerDir {
+			return []LayerDir{
+				{Key: "DIR1", Path: filepath.Join(root, "Background"), Pick: 1},
+				{Key: "DIR2", Path: filepath.Join(root, "Body"), Pick: 1},
+				{Key: "DIR3", Path: filepath.Join(root, "Hat"), Pick: 1},
+			}
+		}, 3},
+		{"picked group members are frames of their own", func(root string) []LayerDir {
+			return []LayerDir{
+				{Key: "DIR1", Path: filepath.Join(root, "Background"), Pick: 1},
+				{Key: "DIR2", Path: filepath.Join(root, "Body"), Pick: 3},
+			}
+		}, 4},
+		{"absent layers have no frame", func(root string) []LayerDir {
+			return []LayerDir{
+				{Key: "DIR1", Path: filepath.Join(root, "Background"), Pick: 1},
+				{Key: "DIR2", Path: filepath.Join(root, "Body"), Pick: 1, Absence: 0.999999},
+				{Key: "DIR3", Path: filepath.Join(root, "Hat"), Pick: 1},
+			}
+		}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for _, trait := range []string{"Background", "Body", "Hat"} {
+				writeLayers(t, filepath.Join(root, trait), "a.png", "b.png", "c.png")
+			}
+			setFlag(t, "seed", "11")
+			t.Setenv("NFT_COUNT", "3")
+			out := filepath.Join(root, "out")
+
+			if err := saveRevealAnimation(2, tt.dirs(root), out); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := os.Open(filepath.Join(out, "reveal_2.gif"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			anim, err := gif.DecodeAll(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(anim.Image) != tt.frames {
+				t.Errorf("%d frames, want %d", len(anim.Image), tt.frames)
+			}
+			for n, delay := range anim.Delay {
+				if delay != *revealDelay {
+					t.Errorf("frame %d has delay %d, want %d", n, delay, *revealDelay)
+				}
+			}
+		})
+	}
+}
+
+func TestRevealMatchesGeneratedToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+		env   []string
+		args  []string
+	}{
+		{"every combination, sampled", 9, nil, []string{"-enumerate-above", "0.5"}},
+		{"near saturation, sampled", 8, []string{"DIR2_ABSENCE=0.3"}, []string{"-enumerate-above", "0.5"}},
+		{"near saturation, re-rolled", 8, nil, []string{"-enumerate-above", "0"}},
+		{"adjacency re-rolls", 6, nil, []string{"-enumerate-above", "0", "-no-adjacent", "Background"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			// Opaque layers, so the PNG round trip keeps the exact colors
+			for n, name := range []string{"dawn.png", "dusk.png", "noon#3.png"} {
+				writePNG(t, filepath.Join(work, "1 Background", name), solid(4, 4, color.NRGBA{uint8(40 + 80*n), 90, 160, 255}))
+			}
+			for n, name := range []string{"crow.png", "gull#2.png", "wren.png"} {
+				bird := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+				draw.Draw(bird, image.Rect(0, 0, 2, 4), image.NewUniform(color.NRGBA{220, uint8(30 + 90*n), 30, 255}), image.Point{}, draw.Src)
+				writePNG(t, filepath.Join(work, "2 Bird", name), bird)
+			}
+			env := append([]string{"DIR1=1 Background", "DIR2=2 Bird", "NFT_COUNT=" + strconv.Itoa(tt.count), "OUTPUT_DIR=out"}, tt.env...)
+			mustRunMixer(t, work, env, append([]string{"-seed", "19"}, tt.args...)...)
+
+			for i := 1; i <= tt.count; i++ {
+				mustRunMixer(t, work, env, append([]string{"-seed", "19", "-reveal-anim", strconv.Itoa(i)}, tt.args...)...)
+				f, err := os.Open(filepath.Join(work, "out", "reveal_"+strconv.Itoa(i)+".gif"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				anim, err := gif.DecodeAll(f)
+				f.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// The last frame is the token's image through the same dithering
+				token := readPNG(t, filepath.Join(work, "out", strconv.Itoa(i)+".png"))
+				want := image.NewPaletted(token.Bounds(), palette.Plan9)
+				draw.FloydSteinberg.Draw(want, token.Bounds(), token, image.Point{})
+				last := anim.Image[len(anim.Image)-1]
+				for p := range want.Pix {
+					if want.Palette[want.Pix[p]] != last.Palette[last.Pix[p]] {
+						t.Errorf("the reveal of token %d ends on another image", i)
+						break
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+var sampleTraits = flag.String("sample-traits", "", "render one image per file of the given trait_type over a fixed base of the other layers")
+
+// listLayerFiles returns the files of a layer directory in name order,
+// skipping subdirectories.
+func listLayerFiles(dir LayerDir) ([]fs.DirEntry, error) {
+	entries, err := readLayerDir(dir.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []fs.DirEntry
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files = append(files, entry)
+		}
+	}
+	return files, nil
+}
+
+// generateTraitSamples writes an image named after the value for every
+// file of the directory whose trait_type is traitType. Every other
+// directory contributes its first file(s), so only the sampled trait
+// changes between images.
+func generateTraitSamples(traitType string, dirs []LayerDir, outputDir string) error {
+	sampled := -1
+	for d, dir := range dirs {
+		if strings.EqualFold(getTraitType(dir), traitType) {
+			sampled = d
+		}
+	}
+	if sampled < 0 {
+		return fmt.Errorf("no layer directory has trait_type '%s'", traitType)
+	}
+
+	var base [][]Layer
+	for _, dir := range dirs {
+		// Grouped directories contribute their first sub-style
+		groups, err := getLayerGroups(dir)
+		if err != nil {
+			return err
+		}
+		group := groups[0]
+
+		files, err := listLayerFiles(group)
+		if err != nil {
+			return err
+		}
+		if len(files) < dir.Pick {
+			return fmt.Errorf("%s needs %d layers but '%s' only has %d", dir.Key, dir.Pick, group.Path, len(files))
+		}
+
+		var layers []Layer
+		for _, file := range files[:dir.Pick] {
+			layers = append(layers, newLayer(getTraitType(dir), group, filepath.Join(group.Path, file.Name())))
+		}
+		base = append(base, layers)
+	}
+
+	files, err := listAssets(dirs[sampled : sampled+1])
+	if err != nil {
+		return err
+	}
+
+	createOutputDir(outputDir)
+
+	for _, file := range files {
+		var layers []Layer
+		for d := range dirs {
+			if d == sampled {
+				layers = append(layers, newLayer(getTraitType(dirs[d]), dirs[d], file))
+				continue
+			}
+			layers = append(layers, base[d]...)
+		}
+
+		err := loadLayers(layers)
+		if err != nil {
+			return err
+		}
+
+		err = writeImage(filepath.Join(outputDir, normalizeName(filepath.Base(file))+getFormatExtension(getOutputFormat())), applyMask(combineLayers(layers)))
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Rendered %d samples of %s\n", len(files), getTraitType(dirs[sampled]))
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestGenerateTraitSamples(t *testing.T) {
+	backgrounds := map[string]color.NRGBA{"a_navy.png": {0, 0, 128, 255}, "b_olive#3.png": {128, 128, 0, 255}, "c_teal.png": {0, 128, 128, 255}}
+	hats := map[string]color.NRGBA{"cap.png": {255, 0, 0, 255}, "crown#0.5.png": {255, 215, 0, 255}}
+
+	tests := []struct {
+		name  string
+		trait string
+		// want maps every sample file to the colors of its left (hat) and
+		// right (background only) half
+		want map[string][2]color.NRGBA
+	}{
+		{"top layer", "Hat", map[string][2]color.NRGBA{
+			"cap.png":   {hats["cap.png"], backgrounds["a_navy.png"]},
+			"crown.png": {hats["crown#0.5.png"], backgrounds["a_navy.png"]},
+		}},
+		{"bottom layer, case insensitive", "background", map[string][2]color.NRGBA{
+			"a_navy.png":  {hats["cap.png"], backgrounds["a_navy.png"]},
+			"b_olive.png": {hats["cap.png"], backgrounds["b_olive#3.png"]},
+			"c_teal.png":  {hats["cap.png"], backgrounds["c_teal.png"]},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, c := range backgrounds {
+				writePNG(t, filepath.Join(root, "1 Background", name), solid(4, 4, c))
+			}
+			for name, c := range hats {
+				hat := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+				for y := 0; y < 4; y++ {
+					hat.SetNRGBA(0, y, c)
+					hat.SetNRGBA(1, y, c)
+				}
+				writePNG(t, filepath.Join(root, "2 Hat", name), hat)
+			}
+			dirs := []LayerDir{
+				{Key: "DIR1", Path: filepath.Join(root, "1 Background"), Pick: 1},
+				{Key: "DIR2", Path: filepath.Join(root, "2 Hat"), Pick: 1},
+			}
+			out := filepath.Join(root, "samples")
+
+			if err := generateTraitSamples(tt.trait, dirs, out); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := os.ReadDir(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, want []string
+			for _, entry := range entries {
+				got = append(got, entry.Name())
+			}
+			for name := range tt.want {
+				want = append(want, name)
+			}
+			sort.Strings(want)
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Fatalf("samples %v, want %v", got, want)
+			}
+
+			for name, colors := range tt.want {
+				img := readPNG(t, filepath.Join(out, name))
+				if left := color.NRGBAModel.Convert(img.At(0, 2)); left != colors[0] {
+					t.Errorf("%s: hat pixel %v, want %v", name, left, colors[0])
+				}
+				if right := color.NRGBAModel.Convert(img.At(3, 2)); right != colors[1] {
+					t.Errorf("%s: background pixel %v, want %v", name, right, colors[1])
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateTraitSamplesUnknownTrait(t *testing.T) {
+	root := t.TempDir()
+	writeLayers(t, filepath.Join(root, "Background"), "a.png")
+	err := generateTraitSamples("Hat", []LayerDir{{Key: "DIR1", Path: filepath.Join(root, "Background"), Pick: 1}}, filepath.Join(root, "out"))
+	if err == nil || !strings.Contains(err.Error(), "'Hat'") {
+		t.Fatalf("got %v, want an error naming the trait_type", err)
+	}
+}
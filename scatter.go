@@ -0,0 +1,174 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"log"
+	"math"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var scatterDir = flag.String("scatter", "", "directory of small sprites (name#weight.png) scattered over every NFT, e.g. confetti or sparkles")
+var scatterCount = flag.String("scatter-count", "1:5", "MIN:MAX number of -scatter sprites drawn per NFT")
+var scatterArea = flag.String("scatter-area", "", "X0,Y0,X1,Y1 area the -scatter sprite centers are placed in (the whole image if empty)")
+
+// scatterSalt salts the number, choice and positions of a token's sprites.
+const scatterSalt = 0x73636174
+
+// Sprite is one scattered sprite, placed with its center at X,Y. Name is
+// the file name without extension and weight.
+type Sprite struct {
+	Name string `json:"name"`
+	X    int    `json:"x"`
+	Y    int    `json:"y"`
+}
+
+// Scatter records the sprites drawn over a token.
+type Scatter struct {
+	Count   int      `json:"count"`
+	Sprites []Sprite `json:"sprites"`
+}
+
+// scatterSprites holds the decoded -scatter pool, loaded on first use.
+var scatterSprites struct {
+	once    sync.Once
+	err     error
+	names   []string
+	weights []float64
+	images  map[string]image.Image
+}
+
+// checkScatterOptions validates -scatter-count and -scatter-area before
+// generating.
+func checkScatterOptions() error {
+	if *scatterDir == "" {
+		return nil
+	}
+	min, max, err := getScatterCount()
+	if err != nil {
+		return err
+	}
+	if min < 0 || min > max {
+		return fmt.Errorf("invalid -scatter-count '%s', expected MIN:MAX with 0 <= MIN <= MAX", *scatterCount)
+	}
+	_, err = getScatterArea(image.Rect(0, 0, 1, 1))
+	return err
+}
+
+func getScatterCount() (int, int, error) {
+	var min, max int
+	_, err := fmt.Sscanf(strings.ReplaceAll(*scatterCount, " ", ""), "%d:%d", &min, &max)
+	if err != nil {
+		_, err = fmt.Sscanf(strings.TrimSpace(*scatterCount), "%d", &min)
+		max = min
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid -scatter-count '%s', expected MIN:MAX", *scatterCount)
+	}
+	return min, max, nil
+}
+
+// getScatterArea returns the area of bounds the sprite centers are placed
+// in.
+func getScatterArea(bounds image.Rectangle) (image.Rectangle, error) {
+	if *scatterArea == "" {
+		return bounds, nil
+	}
+	var area image.Rectangle
+	_, err := fmt.Sscanf(strings.ReplaceAll(*scatterArea, " ", ""), "%d,%d,%d,%d", &area.Min.X, &area.Min.Y, &area.Max.X, &area.Max.Y)
+	if err != nil || area.Empty() {
+		return bounds, fmt.Errorf("invalid -scatter-area '%s', expected X0,Y0,X1,Y1 with X0 < X1 and Y0 < Y1", *scatterArea)
+	}
+	return area.Add(bounds.Min), nil
+}
+
+func loadScatterSprites() error {
+	scatterSprites.once.Do(func() {
+		files, err := readLayerDir(*scatterDir)
+		if err != nil {
+			scatterSprites.err = err
+			return
+		}
+		scatterSprites.images = map[string]image.Image{}
+		for _, file := range files {
+			if file.IsDir() {
+				continue
+			}
+			img, err := decodeLayer(filepath.Join(*scatterDir, file.Name()), GrayHandling{})
+			if err != nil {
+				scatterSprites.err = err
+				return
+			}
+			scatterSprites.names = append(scatterSprites.names, file.Name())
+			scatterSprites.images[normalizeName(file.Name())] = img
+		}
+		scatterSprites.weights = getFileWeights(scatterSprites.names)
+		total := 0.0
+		for _, w := range scatterSprites.weights {
+			total += w
+		}
+		if total <= 0 {
+			scatterSprites.err = fmt.Errorf("-scatter '%s' has no sprite with a weight above 0", *scatterDir)
+		}
+	})
+	return scatterSprites.err
+}
+
+// getScatter draws the sprites of token i over a composite of bounds, the
+// same ones for the same seed and index. It returns nil when -scatter isn't
+// set.
+func getScatter(i int, bounds image.Rectangle) *Scatter {
+	if *scatterDir == "" {
+		return nil
+	}
+	err := loadScatterSprites()
+	if err != nil {
+		log.Fatal(err)
+	}
+	min, max, _ := getScatterCount()
+	area, _ := getScatterArea(bounds)
+
+	rng := saltedRandomizer(scatterSalt, i)
+	scatter := &Scatter{Count: min + rng.Intn(max-min+1), Sprites: []Sprite{}}
+	for s := 0; s < scatter.Count; s++ {
+		name := scatterSprites.names[pickWeighted(rng, scatterSprites.weights)]
+		scatter.Sprites = append(scatter.Sprites, Sprite{
+			Name: normalizeName(name),
+			X:    area.Min.X + int(math.Floor(rng.Float64()*float64(area.Dx()))),
+			Y:    area.Min.Y + int(math.Floor(rng.Float64()*float64(area.Dy()))),
+		})
+	}
+	return scatter
+}
+
+// drawScatter composites the -scatter sprites of token i onto img, on top
+// of the layers.
+func drawScatter(i int, img image.Image) image.Image {
+	scatter := getScatter(i, img.Bounds())
+	if scatter == nil {
+		return img
+	}
+	bounds := img.Bounds()
+	result := image.NewRGBA(bounds)
+	draw.Draw(result, bounds, img, bounds.Min, draw.Src)
+	for _, sprite := range scatter.Sprites {
+		src := scatterSprites.images[sprite.Name]
+		at := image.Pt(sprite.X-src.Bounds().Dx()/2, sprite.Y-src.Bounds().Dy()/2)
+		draw.Draw(result, src.Bounds().Sub(src.Bounds().Min).Add(at), src, src.Bounds().Min, draw.Over)
+	}
+	return result
+}
+
+// compositeBounds returns the bounds of the image combineLayers makes of
+// layers, which must be loaded.
+func compositeBounds(layers []Layer) image.Rectangle {
+	present := presentLayers(layers)
+	if len(present) == 0 {
+		return image.Rectangle{}
+	}
+	return present[0].Image.Bounds()
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScatter(t *testing.T) {
+	sprites := map[string]color.NRGBA{
+		"star":    {255, 220, 0, 255},
+		"heart":   {230, 20, 60, 255},
+		"diamond": {20, 200, 240, 255},
+	}
+	tests := []struct {
+		name     string
+		count    string
+		area     string
+		min, max int
+		// bounds sprite centers must be in
+		within image.Rectangle
+	}{
+		{"whole image", "1:5", "", 1, 5, image.Rect(0, 0, 8, 8)},
+		{"fixed count", "3", "", 3, 3, image.Rect(0, 0, 8, 8)},
+		{"area", "2:4", "2,1,5,3", 2, 4, image.Rect(2, 1, 5, 3)},
+		{"none", "0:0", "", 0, 0, image.Rect(0, 0, 8, 8)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			for _, file := range []string{"red.png", "blue.png"} {
+				writePNG(t, filepath.Join(work, "1 Background", file), solid(8, 8, color.NRGBA{40, 40, 40, 255}))
+			}
+			writeLayers(t, filepath.Join(work, "2 Hat"), "cap.png", "fez.png", "crown.png")
+			for name, c := range sprites {
+				writePNG(t, filepath.Join(work, "sprites", name+".png"), solid(1, 1, c))
+			}
+			args := []string{"-seed", "6", "-scatter", "sprites", "-scatter-count", tt.count}
+			if tt.area != "" {
+				args = append(args, "-scatter-area", tt.area)
+			}
+			env := []string{"DIR1=1 Background", "DIR2=2 Hat", "NFT_COUNT=6"}
+			mustRunMixer(t, work, append(env, "OUTPUT_DIR=out"), args...)
+			out := filepath.Join(work, "out")
+
+			counts := map[int]bool{}
+			for i := 1; i <= 6; i++ {
+				var meta Metadata
+				readJSON(t, filepath.Join(out, fmt.Sprintf("%d.json", i)), &meta)
+				if meta.Scatter == nil {
+					t.Fatalf("token %d has no scatter metadata", i)
+				}
+				scatter := meta.Scatter
+				counts[scatter.Count] = true
+				if scatter.Count < tt.min || scatter.Count > tt.max || len(scatter.Sprites) != scatter.Count {
+					t.Errorf("token %d: count %d with %d sprites, want %d to %d", i, scatter.Count, len(scatter.Sprites), tt.min, tt.max)
+				}
+
+				img := readPNG(t, filepath.Join(out, fmt.Sprintf("%d.png", i)))
+				top := map[image.Point]string{}
+				for _, sprite := range scatter.Sprites {
+					at := image.Pt(sprite.X, sprite.Y)
+					if !at.In(tt.within) {
+						t.Errorf("token %d: %s at %v is outside %v", i, sprite.Name, at, tt.within)
+					}
+					if _, ok := sprites[sprite.Name]; !ok {
+						t.Errorf("token %d: unknown sprite %q", i, sprite.Name)
+					}
+					top[at] = sprite.Name
+				}
+				// The last sprite at a position is the one on top
+				for at, name := range top {
+					if got := color.NRGBAModel.Convert(img.At(at.X, at.Y)); got != sprites[name] {
+						t.Errorf("token %d: pixel %v is %v, want %s %v", i, at, got, name, sprites[name])
+					}
+				}
+			}
+			if tt.min < tt.max && len(counts) < 2 {
+				t.Errorf("every token has the same count, %v", counts)
+			}
+
+			// The same seed places the same sprites
+			mustRunMixer(t, work, append(env, "OUTPUT_DIR=again"), args...)
+			diffTrees(t, mustReadTree(t, filepath.Join(work, "again")), mustReadTree(t, out))
+
+			// Re-rendering takes the seed from the manifest and draws the
+			// sprites again where they were
+			before := mustReadTree(t, out)
+			rerender := append([]string{"-rerender-affected", filepath.Join("2 Hat", "cap.png")}, args[2:]...)
+			got := mustRunMixer(t, work, append(env, "OUTPUT_DIR=out"), rerender...)
+			if !strings.Contains(got, "Re-rendered") {
+				t.Fatalf("no tokens re-rendered:\n%s", got)
+			}
+			after := mustReadTree(t, out)
+			for name, data := range before {
+				if strings.HasSuffix(name, ".png") && !bytes.Equal(after[name], data) {
+					t.Errorf("re-rendered %s differs", name)
+				}
+			}
+		})
+	}
+}
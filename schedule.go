@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var revealStart = flag.String("reveal-start", "", "write reveal_schedule.json with staggered reveal times starting at this RFC 3339 time, e.g. 2026-11-01T18:00:00Z")
+var revealBatch = flag.Int("reveal-batch", 100, "number of tokens revealed together in the -reveal-start schedule")
+var revealEvery = flag.Duration("reveal-every", time.Hour, "time between two -reveal-start batches")
+
+// RevealSchedule is written to reveal_schedule.json. Until its reveal_at a
+// token should be served with placeholder metadata.
+type RevealSchedule struct {
+	Start  time.Time     `json:"start"`
+	Batch  int           `json:"batch"`
+	Every  string        `json:"every"`
+	Tokens []TokenReveal `json:"tokens"`
+}
+
+type TokenReveal struct {
+	Index    int       `json:"index"`
+	RevealAt time.Time `json:"reveal_at"`
+}
+
+// getRevealStart parses -reveal-start and checks the cadence options.
+func getRevealStart() (time.Time, error) {
+	start, err := time.Parse(time.RFC3339, *revealStart)
+	if err != nil {
+		return start, fmt.Errorf("invalid -reveal-start '%s', expected an RFC 3339 time such as 2026-11-01T18:00:00Z", *revealStart)
+	}
+	if *revealBatch < 1 {
+		return start, fmt.Errorf("invalid -reveal-batch %d, it must be at least 1", *revealBatch)
+	}
+	if *revealEvery <= 0 {
+		return start, fmt.Errorf("invalid -reveal-every %s, it must be positive", *revealEvery)
+	}
+	return start.UTC(), nil
+}
+
+// buildRevealSchedule reveals indexes in order, -reveal-batch of them at
+// a time every -reveal-every from start.
+func buildRevealSchedule(start time.Time, indexes []int) RevealSchedule {
+	schedule := RevealSchedule{Start: start, Batch: *revealBatch, Every: revealEvery.String(), Tokens: []TokenReveal{}}
+	for position, i := range indexes {
+		at := start.Add(time.Duration(position / *revealBatch) * *revealEvery)
+		schedule.Tokens = append(schedule.Tokens, TokenReveal{Index: i, RevealAt: at})
+	}
+	return schedule
+}
+
+func saveRevealSchedule(tokens *tokenStore, outputDir string) error {
+	start, err := getRevealStart()
+	if err != nil {
+		return err
+	}
+	data, err := encodeJSON(buildRevealSchedule(start, tokens.indexes()))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outputDir, "reveal_schedule.json"), data, 0644)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRevealSchedule(t *testing.T) {
+	tests := []struct {
+		name  string
+		start string
+		batch string
+		every string
+		// batches are the token indexes revealed together, in order
+		batches [][]int
+		gap     time.Duration
+	}{
+		{"batches of three", "2026-11-01T18:00:00Z", "3", "90m", [][]int{{1, 2, 3}, {4, 5, 6}, {7}}, 90 * time.Minute},
+		{"one at a time", "2026-11-01T18:00:00Z", "1", "10s", [][]int{{1}, {2}, {3}, {4}, {5}, {6}, {7}}, 10 * time.Second},
+		{"one batch", "2026-11-01T18:00:00Z", "10", "1h", [][]int{{1, 2, 3, 4, 5, 6, 7}}, time.Hour},
+		{"offset start", "2026-11-01T20:30:00+02:00", "4", "24h", [][]int{{1, 2, 3, 4}, {5, 6, 7}}, 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "dawn.png", "dusk.png", "noon.png")
+			writeLayers(t, filepath.Join(work, "2 Bird"), "crow.png", "gull.png", "wren.png")
+			env := []string{"DIR1=1 Background", "DIR2=2 Bird", "NFT_COUNT=7", "OUTPUT_DIR=out"}
+			mustRunMixer(t, work, env, "-reveal-start", tt.start, "-reveal-batch", tt.batch, "-reveal-every", tt.every)
+
+			var schedule RevealSchedule
+			readJSON(t, filepath.Join(work, "out", "reveal_schedule.json"), &schedule)
+			start, _ := time.Parse(time.RFC3339, tt.start)
+			if !schedule.Start.Equal(start) || schedule.Start.Location() != time.UTC {
+				t.Errorf("start is %v, want %v in UTC", schedule.Start, start)
+			}
+
+			n := 0
+			for b, batch := range tt.batches {
+				want := start.Add(time.Duration(b) * tt.gap)
+				for _, i := range batch {
+					if n >= len(schedule.Tokens) {
+						t.Fatalf("schedule ends after %d tokens", n)
+					}
+					token := schedule.Tokens[n]
+					if token.Index != i || !token.RevealAt.Equal(want) {
+						t.Errorf("entry %d is token %d at %v, want token %d at %v", n, token.Index, token.RevealAt, i, want)
+					}
+					n++
+				}
+			}
+			if n != len(schedule.Tokens) {
+				t.Errorf("schedule has %d tokens, want %d", len(schedule.Tokens), n)
+			}
+		})
+	}
+}
+
+func TestInvalidRevealSchedule(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{"start", []string{"-reveal-start", "tomorrow"}, "invalid -reveal-start 'tomorrow'"},
+		{"batch", []string{"-reveal-start", "2026-11-01T18:00:00Z", "-reveal-batch", "0"}, "invalid -reveal-batch 0"},
+		{"every", []string{"-reveal-start", "2026-11-01T18:00:00Z", "-reveal-every", "-1h"}, "invalid -reveal-every -1h0m0s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "dawn.png", "dusk.png")
+			out, err := runMixer(t, work, []string{"DIR1=1 Background", "NFT_COUNT=2", "OUTPUT_DIR=out"}, tt.args...)
+			if err == nil {
+				t.Fatalf("run succeeded:\n%s", out)
+			}
+			if !strings.Contains(out, tt.err) {
+				t.Errorf("output doesn't say %q:\n%s", tt.err, out)
+			}
+			if _, err := os.Stat(filepath.Join(work, "out")); !os.IsNotExist(err) {
+				t.Error("the output directory was created")
+			}
+		})
+	}
+}
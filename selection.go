@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// tokenSelector draws the layers of a collection's tokens in index order,
+// the way a generation run does. Near saturation the combinations come from
+// the sampler, otherwise selectToken is re-rolled until the combination is
+// new and, for -no-adjacent, differs from the token before.
+type tokenSelector struct {
+	dirs    []LayerDir
+	sampler *combinationSampler
+	// exists tells whether a combination, by getCacheKey, was already taken.
+	exists func(key string) bool
+	// previous holds the layers of the token before, without its bonus.
+	previous []Layer
+}
+
+func (s *tokenSelector) next(i int) ([]Layer, error) {
+	rng := tokenRand(i)
+	if s.sampler != nil {
+		s.previous = s.sampler.draw(rng)
+		return s.previous, nil
+	}
+
+	for attempt := 0; ; attempt++ {
+		layers, err := selectToken(i, rng, s.dirs, rerolls)
+		if err != nil {
+			return nil, fmt.Errorf("error reading layers from dirs: %v", err)
+		}
+
+		if !s.exists(getCacheKey(layers)) {
+			// Adjacency is a soft rule, after too many re-rolls it gives way
+			trait := sharedAdjacentTrait(s.previous, layers)
+			if trait == "" || attempt >= maxRerolls {
+				if trait != "" {
+					log.Printf("Warning: NFT %d shares its %s with NFT %d after %d attempts", i, trait, i-1, maxRerolls)
+				}
+				s.previous = layers
+				return layers, nil
+			}
+			rerolls.add("no-adjacent")
+			continue
+		}
+
+		// The combination was drawn before, re-roll this NFT
+		fmt.Println(getCacheKey(layers), "already exists")
+		rerolls.add("duplicate")
+		if attempt >= maxRerolls {
+			return nil, fmt.Errorf("could not find a unique combination for NFT %d after %d attempts", i, maxRerolls)
+		}
+	}
+}
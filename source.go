@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LayerSource is where layer directories and files are read from.
+type LayerSource interface {
+	ReadDir(name string) ([]fs.DirEntry, error)
+	ReadFile(name string) ([]byte, error)
+}
+
+// layerSource is the local filesystem unless a build replaces it, see
+// embed_layers.go.
+var layerSource LayerSource = osSource{}
+
+// readLayerDir lists a directory of layerSource sorted by name. The
+// selection indexes into this list, so a source returning entries in
+// another order must not change which files a seed picks.
+func readLayerDir(name string) ([]fs.DirEntry, error) {
+	entries, err := layerSource.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+type osSource struct{}
+
+func (osSource) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (osSource) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+// fsSource reads layers from an fs.FS such as an embed.FS. DIR<n> paths are
+// interpreted relative to the root of the FS.
+type fsSource struct {
+	fsys fs.FS
+}
+
+func (s fsSource) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(s.fsys, fsPath(name))
+}
+
+func (s fsSource) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(s.fsys, fsPath(name))
+}
+
+// fsPath converts an OS style path such as ./my_layers/1 into the slash
+// separated, unrooted form fs.FS requires.
+func fsPath(name string) string {
+	name = path.Clean(filepath.ToSlash(name))
+	return strings.TrimPrefix(name, "/")
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"embed"
+	"image/color"
+	"io/fs"
+	"path/filepath"
+	"testing"
+)
+
+//go:embed testdata/embedded
+var embeddedFixture embed.FS
+
+// fixtureColors are the colors of the testdata/embedded layer files. Faces
+// only cover the left half of the image.
+var fixtureColors = map[string]color.NRGBA{
+	"navy.png":    {0, 0, 128, 255},
+	"olive#2.png": {128, 128, 0, 255},
+	"teal.png":    {0, 128, 128, 255},
+	"happy.png":   {255, 200, 0, 255},
+	"sad.png":     {90, 90, 255, 255},
+}
+
+func TestGenerateFromEmbeddedLayers(t *testing.T) {
+	tests := []struct {
+		name   string
+		source func(t *testing.T) (LayerSource, string)
+	}{
+		{"embed.FS", func(t *testing.T) (LayerSource, string) {
+			return fsSource{embeddedFixture}, "./testdata/embedded"
+		}},
+		{"embed.FS with a rooted path", func(t *testing.T) (LayerSource, string) {
+			return fsSource{embeddedFixture}, "/testdata/embedded"
+		}},
+		{"copy on disk", func(t *testing.T) (LayerSource, string) {
+			root := t.TempDir()
+			err := fs.WalkDir(embeddedFixture, "testdata/embedded", func(path string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				data, err := embeddedFixture.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				writeFile(t, filepath.Join(root, filepath.FromSlash(path)), string(data))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return osSource{}, filepath.Join(root, "testdata", "embedded")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, root := tt.source(t)
+			old := layerSource
+			layerSource = source
+			t.Cleanup(func() { layerSource = old })
+			setFlag(t, "seed", "42")
+
+			dirs := []LayerDir{
+				{Key: "DIR1", Path: root + "/1 Background", Pick: 1},
+				{Key: "DIR2", Path: root + "/2 Face", Pick: 1},
+			}
+			drawn := map[string]bool{}
+			for i := 1; i <= 12; i++ {
+				layers, err := selectToken(i, tokenRand(i), dirs, rerolls)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := loadLayers(layers); err != nil {
+					t.Fatal(err)
+				}
+				img := combineLayers(layers)
+
+				background, face := fixtureColors[layers[0].Name], fixtureColors[layers[1].Name]
+				if got := color.NRGBAModel.Convert(img.At(0, 0)); got != face {
+					t.Errorf("token %d: face pixel %v, want %s %v", i, got, layers[1].Name, face)
+				}
+				if got := color.NRGBAModel.Convert(img.At(3, 3)); got != background {
+					t.Errorf("token %d: background pixel %v, want %s %v", i, got, layers[0].Name, background)
+				}
+				drawn[layers[0].Name] = true
+			}
+			if len(drawn) < 2 {
+				t.Errorf("every token drew the same background: %v", drawn)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"image"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+var thumbnails = flag.Int("thumbnails", 0, "also write thumbnails/<index> images in OUTPUT_FORMAT with the longest side scaled to N pixels")
+
+// makeThumbnail scales img so its longest side is size. Bilinear filtering
+// only looks at 4 pixels, so large reductions are done in halving steps to
+// avoid aliasing.
+func makeThumbnail(img image.Image, size int) *image.RGBA {
+	w, h := scaleLongestSide(img.Bounds(), size)
+	for img.Bounds().Dx() >= 2*w && img.Bounds().Dy() >= 2*h {
+		img = resizeImage(img, img.Bounds().Dx()/2, img.Bounds().Dy()/2)
+	}
+	return resizeImage(img, w, h)
+}
+
+// saveThumbnail writes the thumbnail of token i to the thumbnails folder
+// of outputDir, encoded like the token's image.
+func saveThumbnail(i int, img image.Image, outputDir string) error {
+	dir := filepath.Join(outputDir, "thumbnails")
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	return writeImage(filepath.Join(dir, strconv.Itoa(i)+getFormatExtension(getOutputFormat())), makeThumbnail(img, *thumbnails))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestThumbnails(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		size          int
+		chunkSize     int
+		want          image.Rectangle
+	}{
+		{"square", 32, 32, 8, 0, image.Rect(0, 0, 8, 8)},
+		{"wide", 40, 20, 10, 0, image.Rect(0, 0, 10, 5)},
+		{"tall", 30, 90, 12, 0, image.Rect(0, 0, 4, 12)},
+		{"chunked output", 24, 24, 6, 2, image.Rect(0, 0, 6, 6)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			for n, name := range []string{"dawn.png", "dusk.png", "noon.png"} {
+				writePNG(t, filepath.Join(work, "1 Sky", name), solid(tt.width, tt.height, color.NRGBA{uint8(80 * n), 90, 200, 255}))
+			}
+			for n, name := range []string{"bird.png", "cloud.png"} {
+				writePNG(t, filepath.Join(work, "2 Thing", name), solid(tt.width, tt.height, color.NRGBA{200, uint8(100 * n), 40, 120}))
+			}
+			env := []string{"DIR1=1 Sky", "DIR2=2 Thing", "NFT_COUNT=5", "OUTPUT_DIR=out"}
+			mustRunMixer(t, work, env, "-seed", "6", "-thumbnails", strconv.Itoa(tt.size), "-chunk-size", strconv.Itoa(tt.chunkSize))
+
+			entries, err := os.ReadDir(filepath.Join(work, "out", "thumbnails"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 5 {
+				t.Errorf("%d thumbnails, want 5", len(entries))
+			}
+			for i := 1; i <= 5; i++ {
+				thumb := readPNG(t, filepath.Join(work, "out", "thumbnails", strconv.Itoa(i)+".png"))
+				if thumb.Bounds() != tt.want {
+					t.Errorf("thumbnail %d is %v, want %v", i, thumb.Bounds(), tt.want)
+				}
+				tokenDir := filepath.Join(work, "out")
+				if tt.chunkSize > 0 {
+					tokenDir = filepath.Join(tokenDir, fmt.Sprintf("batch_%04d", (i-1)/tt.chunkSize+1))
+				}
+				full := readPNG(t, filepath.Join(tokenDir, strconv.Itoa(i)+".png"))
+				if full.Bounds() != image.Rect(0, 0, tt.width, tt.height) {
+					t.Errorf("image %d is %v, want the full size", i, full.Bounds())
+				}
+				// Flat layers keep their color when scaled down
+				got, want := color.NRGBAModel.Convert(thumb.At(0, 0)).(color.NRGBA), color.NRGBAModel.Convert(full.At(0, 0)).(color.NRGBA)
+				if !near(got, want) {
+					t.Errorf("thumbnail %d is %v, its image %v", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestThumbnailFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		env  []string
+		args []string
+		file string
+		// format is the one image.DecodeConfig reports, paletted whether
+		// -optimize reduced the PNG to a palette
+		format   string
+		paletted bool
+	}{
+		{"png", nil, nil, "1.png", "png", false},
+		{"jpeg", []string{"OUTPUT_FORMAT=jpeg"}, nil, "1.jpg", "jpeg", false},
+		{"optimized png", nil, []string{"-optimize"}, "1.png", "png", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writePNG(t, filepath.Join(work, "1 Sky", "dawn.png"), solid(16, 16, color.NRGBA{80, 90, 200, 255}))
+			writePNG(t, filepath.Join(work, "2 Thing", "bird.png"), solid(8, 8, color.NRGBA{200, 100, 40, 255}))
+			env := append([]string{"DIR1=1 Sky", "DIR2=2 Thing", "NFT_COUNT=1", "OUTPUT_DIR=out"}, tt.env...)
+			mustRunMixer(t, work, env, append([]string{"-seed", "6", "-thumbnails", "8"}, tt.args...)...)
+
+			entries, err := os.ReadDir(filepath.Join(work, "out", "thumbnails"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Name() != tt.file {
+				t.Fatalf("thumbnails are %v, want %s", entries, tt.file)
+			}
+			f, err := os.Open(filepath.Join(work, "out", "thumbnails", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			config, format, err := image.DecodeConfig(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format != tt.format || config.Width != 8 || config.Height != 8 {
+				t.Errorf("thumbnail is a %dx%d %s, want an 8x8 %s", config.Width, config.Height, format, tt.format)
+			}
+			if _, paletted := config.ColorModel.(color.Palette); paletted != tt.paletted {
+				t.Errorf("thumbnail paletted %t, want %t", paletted, tt.paletted)
+			}
+		})
+	}
+}
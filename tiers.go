@@ -0,0 +1,106 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var splitTiers = flag.Bool("split-tiers", false, "copy every token into common/, uncommon/, rare/ and legendary/ by rarity rank")
+var tierPercentiles = flag.String("tier-percentiles", "60,85,97", "rank percentiles where the uncommon, rare and legendary tiers start")
+
+var tierNames = []string{"common", "uncommon", "rare", "legendary"}
+
+// rarityScores returns the rarity score of every token: the sum over its
+// attributes of how many times rarer than certain each value is.
+func rarityScores(tokens *tokenStore) map[int]float64 {
+	tokens.mu.Lock()
+	defer tokens.mu.Unlock()
+
+	counts := traitCounts(tokens.metas)
+	total := float64(len(tokens.metas))
+
+	scores := map[int]float64{}
+	for i, meta := range tokens.metas {
+		for _, attr := range meta.Attributes {
+			scores[i] += total / float64(counts[attr.TraitType][attr.Value])
+		}
+	}
+	return scores
+}
+
+// rankByRarity returns the token indexes from most common to rarest. Ties
+// keep index order so the ranking is reproducible.
+func rankByRarity(tokens *tokenStore) []int {
+	scores := rarityScores(tokens)
+	indexes := tokens.indexes()
+	sort.SliceStable(indexes, func(a, b int) bool {
+		return scores[indexes[a]] < scores[indexes[b]]
+	})
+	return indexes
+}
+
+func parseTierPercentiles(value string) ([]float64, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != len(tierNames)-1 {
+		return nil, fmt.Errorf("-tier-percentiles needs %d values, got '%s'", len(tierNames)-1, value)
+	}
+
+	bounds := make([]float64, len(parts))
+	for p, part := range parts {
+		bound, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || bound < 0 || bound > 100 || (p > 0 && bound < bounds[p-1]) {
+			return nil, fmt.Errorf("invalid -tier-percentiles '%s', expected increasing percentages", value)
+		}
+		bounds[p] = bound
+	}
+	return bounds, nil
+}
+
+// splitIntoTiers copies the image and metadata of every token into the tier
+// folder its rarity percentile falls in.
+func splitIntoTiers(tokens *tokenStore, outputDir string) error {
+	bounds, err := parseTierPercentiles(*tierPercentiles)
+	if err != nil {
+		return err
+	}
+
+	ranked := rankByRarity(tokens)
+	perTier := make([]int, len(tierNames))
+
+	for position, i := range ranked {
+		percentile := float64(position) / float64(len(ranked)) * 100
+		tier := 0
+		for tier < len(bounds) && percentile >= bounds[tier] {
+			tier++
+		}
+		perTier[tier]++
+
+		tierDir := filepath.Join(outputDir, tierNames[tier])
+		err := os.MkdirAll(tierDir, 0755)
+		if err != nil {
+			return err
+		}
+
+		tokenDir := getTokenDir(outputDir, i)
+		for _, name := range []string{tokens.metas[i].Image, fmt.Sprintf("%d.json", i)} {
+			data, err := os.ReadFile(filepath.Join(tokenDir, name))
+			if err != nil {
+				return err
+			}
+			err = os.WriteFile(filepath.Join(tierDir, name), data, 0644)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for tier, name := range tierNames {
+		fmt.Printf("%s: %d tokens\n", name, perTier[tier])
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitIntoTiers(t *testing.T) {
+	// Rarer kinds score higher, so tokens 1..10 are already ranked from
+	// most common to rarest
+	kinds := []string{"plain", "plain", "plain", "plain", "striped", "striped", "striped", "spotted", "spotted", "golden"}
+
+	tests := []struct {
+		name        string
+		percentiles string
+		tiers       map[string][]int
+	}{
+		{"default-like bounds", "50,80,90", map[string][]int{
+			"common": {1, 2, 3, 4, 5}, "uncommon": {6, 7, 8}, "rare": {9}, "legendary": {10},
+		}},
+		{"empty middle tiers", "70,70,70", map[string][]int{
+			"common": {1, 2, 3, 4, 5, 6, 7}, "uncommon": nil, "rare": nil, "legendary": {8, 9, 10},
+		}},
+		{"everything legendary", "0,0,0", map[string][]int{
+			"common": nil, "uncommon": nil, "rare": nil, "legendary": {1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		}},
+		{"everything common", "100,100,100", map[string][]int{
+			"common": {1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, "uncommon": nil, "rare": nil, "legendary": nil,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := t.TempDir()
+			tokens := newTokenStore()
+			for n, kind := range kinds {
+				i := n + 1
+				meta := Metadata{Image: fmt.Sprintf("%d.png", i), Attributes: []Attribute{{TraitType: "Kind", Value: kind}}}
+				tokens.add(i, meta, nil)
+				writeFile(t, filepath.Join(out, meta.Image), "image "+kind)
+				writeFile(t, filepath.Join(out, fmt.Sprintf("%d.json", i)), "metadata "+kind)
+			}
+			setFlag(t, "tier-percentiles", tt.percentiles)
+
+			if err := splitIntoTiers(tokens, out); err != nil {
+				t.Fatal(err)
+			}
+			for _, tier := range tierNames {
+				var got []int
+				for i := 1; i <= len(kinds); i++ {
+					image, imageErr := os.ReadFile(filepath.Join(out, tier, fmt.Sprintf("%d.png", i)))
+					_, metaErr := os.Stat(filepath.Join(out, tier, fmt.Sprintf("%d.json", i)))
+					if (imageErr == nil) != (metaErr == nil) {
+						t.Errorf("%s holds only one file of token %d", tier, i)
+					}
+					if imageErr == nil {
+						got = append(got, i)
+						if string(image) != "image "+kinds[i-1] {
+							t.Errorf("%s/%d.png holds %q", tier, i, image)
+						}
+					}
+				}
+				if !reflect.DeepEqual(got, tt.tiers[tier]) {
+					t.Errorf("%s holds tokens %v, want %v", tier, got, tt.tiers[tier])
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidTierPercentiles(t *testing.T) {
+	for _, value := range []string{"60,85", "60,85,97,99", "85,60,97", "60,85,101", "-1,85,97", "60,x,97"} {
+		if _, err := parseTierPercentiles(value); err == nil {
+			t.Errorf("-tier-percentiles %s accepted", value)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+var traitsJSON = flag.Bool("traits-json", false, "write traits.json with every possible value per trait_type, its configured weight and probability, derived from the layer files instead of the tokens")
+
+// TraitValue is one possible value of a trait_type.
+type TraitValue struct {
+	Value string `json:"value"`
+	// Weight is the sum of the file weights of the value, 0 for None.
+	Weight float64 `json:"weight"`
+	// Probability is the chance that a token gets the value.
+	Probability float64 `json:"probability"`
+	// Expected is Probability times NFT_COUNT.
+	Expected float64 `json:"expected"`
+	// Files is the number of layer files shown as the value.
+	Files int `json:"files"`
+}
+
+type TraitType struct {
+	TraitType string       `json:"trait_type"`
+	Values    []TraitValue `json:"values"`
+}
+
+// getTraitValues lists the possible values of each directory with their
+// probabilities from the weights, absence and DIR<n>_PICK. Files that show
+// up as the same value, e.g. through DIR<n>_VALUES, are merged.
+func getTraitValues(dirs []LayerDir, nftCount int) ([]TraitType, error) {
+	round := func(v float64) float64 {
+		return math.Round(v*10000) / 10000
+	}
+
+	traitTypes := []TraitType{}
+	for _, dir := range dirs {
+		trait := getTraitType(dir)
+		options, err := getLayerOptions(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		values := map[string]*TraitValue{}
+		valueOf := func(name string) *TraitValue {
+			if values[name] == nil {
+				values[name] = &TraitValue{Value: name}
+			}
+			return values[name]
+		}
+		for _, option := range options {
+			if len(option.files) == 0 {
+				valueOf(noneTrait).Probability += option.weight
+				continue
+			}
+			// A value picked twice for one token still counts once
+			seen := map[string]bool{}
+			for _, path := range option.files {
+				value := attributeValue(Layer{Name: filepath.Base(path), Trait: trait, Path: path})
+				if !seen[value] {
+					valueOf(value).Probability += option.weight
+					seen[value] = true
+				}
+			}
+		}
+
+		assets, err := listAssets([]LayerDir{dir})
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range assets {
+			value := attributeValue(Layer{Name: filepath.Base(path), Trait: trait, Path: path})
+			valueOf(value).Weight += getWeight(filepath.Base(path))
+			values[value].Files++
+		}
+
+		traitType := TraitType{TraitType: trait, Values: []TraitValue{}}
+		for _, value := range values {
+			value.Expected = round(value.Probability * float64(nftCount))
+			value.Probability = round(value.Probability)
+			traitType.Values = append(traitType.Values, *value)
+		}
+		sort.Slice(traitType.Values, func(a, b int) bool {
+			return traitType.Values[a].Value < traitType.Values[b].Value
+		})
+		traitTypes = append(traitTypes, traitType)
+	}
+
+	if *bonusLayer != "" {
+		name := filepath.Base(*bonusLayer)
+		traitTypes = append(traitTypes, TraitType{TraitType: *bonusTrait, Values: []TraitValue{{
+			Value:       attributeValue(Layer{Name: name, Trait: *bonusTrait, Path: *bonusLayer}),
+			Weight:      getWeight(name),
+			Probability: round(*bonusChance),
+			Expected:    round(*bonusChance * float64(nftCount)),
+			Files:       1,
+		}}})
+	}
+	return traitTypes, nil
+}
+
+func saveTraitValues(dirs []LayerDir, nftCount int, outputDir string) error {
+	traitTypes, err := getTraitValues(dirs, nftCount)
+	if err != nil {
+		return err
+	}
+	data, err := encodeJSON(traitTypes)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outputDir, "traits.json"), data, 0644)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTraitsJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		env  []string
+		args []string
+		want []TraitType
+	}{
+		{"weights", nil, nil, []TraitType{
+			{"Background", []TraitValue{
+				{Value: "blue", Weight: 1, Probability: 0.25, Expected: 1, Files: 1},
+				{Value: "ghost", Weight: 0, Probability: 0, Expected: 0, Files: 1},
+				{Value: "red", Weight: 3, Probability: 0.75, Expected: 3, Files: 1},
+			}},
+			{"Hat", []TraitValue{
+				{Value: "cap_1", Weight: 1, Probability: 0.3333, Expected: 1.3333, Files: 1},
+				{Value: "cap_2", Weight: 1, Probability: 0.3333, Expected: 1.3333, Files: 1},
+				{Value: "fez", Weight: 1, Probability: 0.3333, Expected: 1.3333, Files: 1},
+			}},
+		}},
+		{"absence and merged values", []string{"DIR2_ABSENCE=0.5", "DIR2_VALUES=strip-number,title"}, nil, []TraitType{
+			{"Background", []TraitValue{
+				{Value: "blue", Weight: 1, Probability: 0.25, Expected: 1, Files: 1},
+				{Value: "ghost", Weight: 0, Probability: 0, Expected: 0, Files: 1},
+				{Value: "red", Weight: 3, Probability: 0.75, Expected: 3, Files: 1},
+			}},
+			{"Hat", []TraitValue{
+				{Value: "Cap", Weight: 2, Probability: 0.3333, Expected: 1.3333, Files: 2},
+				{Value: "Fez", Weight: 1, Probability: 0.1667, Expected: 0.6667, Files: 1},
+				{Value: noneTrait, Weight: 0, Probability: 0.5, Expected: 2, Files: 0},
+			}},
+		}},
+		{"bonus layer", nil, []string{"-bonus-layer", "halo.png", "-bonus-chance", "0.1"}, []TraitType{
+			{"Background", []TraitValue{
+				{Value: "blue", Weight: 1, Probability: 0.25, Expected: 1, Files: 1},
+				{Value: "ghost", Weight: 0, Probability: 0, Expected: 0, Files: 1},
+				{Value: "red", Weight: 3, Probability: 0.75, Expected: 3, Files: 1},
+			}},
+			{"Hat", []TraitValue{
+				{Value: "cap_1", Weight: 1, Probability: 0.3333, Expected: 1.3333, Files: 1},
+				{Value: "cap_2", Weight: 1, Probability: 0.3333, Expected: 1.3333, Files: 1},
+				{Value: "fez", Weight: 1, Probability: 0.3333, Expected: 1.3333, Files: 1},
+			}},
+			{"Bonus", []TraitValue{
+				{Value: "halo", Weight: 1, Probability: 0.1, Expected: 0.4, Files: 1},
+			}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "red#3.png", "blue.png", "ghost#0.png")
+			writeLayers(t, filepath.Join(work, "2 Hat"), "cap_1.png", "cap_2.png", "fez.png")
+			writeLayers(t, work, "halo.png")
+			env := append([]string{"DIR1=1 Background", "DIR2=2 Hat", "NFT_COUNT=4"}, tt.env...)
+			mustRunMixer(t, work, append(env, "OUTPUT_DIR=out"), append([]string{"-seed", "1", "-traits-json"}, tt.args...)...)
+
+			var got []TraitType
+			readJSON(t, filepath.Join(work, "out", "traits.json"), &got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("traits.json is\n%+v\nwant\n%+v", got, tt.want)
+			}
+
+			// The values come from the layer files, not the drawn tokens
+			mustRunMixer(t, work, append(env, "OUTPUT_DIR=other"), append([]string{"-seed", "2", "-traits-json"}, tt.args...)...)
+			first, _ := os.ReadFile(filepath.Join(work, "out", "traits.json"))
+			second, _ := os.ReadFile(filepath.Join(work, "other", "traits.json"))
+			if !bytes.Equal(first, second) {
+				t.Error("traits.json changes with the seed")
+			}
+		})
+	}
+}
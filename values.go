@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+var displayValueFile = flag.String("display-values", "", "JSON file of attribute values per trait_type and layer name, {\"Background\": {\"bg_deep_space_01\": \"Deep Space\"}}, overriding DIR<n>_VALUES")
+
+// ValueTransform is one step of a directory's DIR<n>_VALUES list.
+type ValueTransform struct {
+	// Op is strip-prefix, strip-suffix, strip-number, spaces, title, upper
+	// or lower.
+	Op  string
+	Arg string
+}
+
+// getValueTransforms parses <prefix>_VALUES, a comma separated list of
+// strip-prefix:P, strip-suffix:S, strip-number, spaces, title, upper and
+// lower steps run in order on the layer name.
+func getValueTransforms(prefix string) []ValueTransform {
+	value := os.Getenv(prefix + "_VALUES")
+	if value == "" {
+		return nil
+	}
+
+	var transforms []ValueTransform
+	for _, spec := range strings.Split(value, ",") {
+		op, arg, hasArg := strings.Cut(strings.TrimSpace(spec), ":")
+		switch op {
+		case "strip-prefix", "strip-suffix":
+			if !hasArg || arg == "" {
+				log.Fatalf("Invalid %s_VALUES step '%s', %s needs the text to strip", prefix, spec, op)
+			}
+		case "strip-number", "spaces", "title", "upper", "lower":
+			if hasArg {
+				log.Fatalf("Invalid %s_VALUES step '%s', %s takes no argument", prefix, spec, op)
+			}
+		default:
+			log.Fatalf("Invalid %s_VALUES step '%s', expected strip-prefix:P, strip-suffix:S, strip-number, spaces, title, upper or lower", prefix, spec)
+		}
+		transforms = append(transforms, ValueTransform{Op: op, Arg: arg})
+	}
+	return transforms
+}
+
+var trailingNumber = regexp.MustCompile(`[\s_-]*\d+$`)
+
+func (t ValueTransform) apply(value string) string {
+	switch t.Op {
+	case "strip-prefix":
+		return strings.TrimPrefix(value, t.Arg)
+	case "strip-suffix":
+		return strings.TrimSuffix(value, t.Arg)
+	case "strip-number":
+		return trailingNumber.ReplaceAllString(value, "")
+	case "spaces":
+		return strings.Join(strings.FieldsFunc(value, func(r rune) bool {
+			return r == '_' || r == '-' || unicode.IsSpace(r)
+		}), " ")
+	case "title":
+		words := strings.Fields(value)
+		for w, word := range words {
+			runes := []rune(strings.ToLower(word))
+			runes[0] = unicode.ToUpper(runes[0])
+			words[w] = string(runes)
+		}
+		return strings.Join(words, " ")
+	case "upper":
+		return strings.ToUpper(value)
+	case "lower":
+		return strings.ToLower(value)
+	}
+	return value
+}
+
+// valueTransforms maps a trait_type to the DIR<n>_VALUES of its directory.
+var valueTransforms = map[string][]ValueTransform{}
+
+// displayValues maps a trait_type to the -display-values of its layers.
+var displayValues map[string]map[string]string
+
+// loadDisplayValues records the value transforms of dirs and reads the
+// -display-values overrides.
+func loadDisplayValues(dirs []LayerDir) error {
+	for _, dir := range dirs {
+		valueTransforms[getTraitType(dir)] = dir.Values
+	}
+
+	if *displayValueFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(*displayValueFile)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, &displayValues)
+	if err != nil {
+		return fmt.Errorf("invalid -display-values file '%s': %v", *displayValueFile, err)
+	}
+	return nil
+}
+
+// attributeValue returns the metadata value of layer: its -display-values
+// override if it has one, otherwise its normalized name run through the
+// transforms of its directory. A left out layer stays None.
+func attributeValue(layer Layer) string {
+	name := normalizeName(layer.Name)
+	if layer.Path == "" {
+		return name
+	}
+	if value, ok := displayValues[layer.Trait][name]; ok {
+		return value
+	}
+
+	value := name
+	for _, t := range valueTransforms[layer.Trait] {
+		value = t.apply(value)
+	}
+	if value == "" {
+		return name
+	}
+	return value
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAttributeValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform string
+		overrides string
+		file      string
+		want      string
+	}{
+		{"no transforms", "", "", "bg_deep_space_01.png", "bg_deep_space_01"},
+		{"full pipeline", "strip-prefix:bg_,strip-number,spaces,title", "", "bg_deep_space_01.png", "Deep Space"},
+		{"steps run in order", "spaces,strip-prefix:bg_,title", "", "bg_deep_space_01.png", "Bg Deep Space 01"},
+		{"weight suffix comes off first", "strip-prefix:bg_,strip-number,spaces,title", "", "bg_deep_space_01#4.png", "Deep Space"},
+		{"suffix and case", "strip-suffix:_v2,spaces,upper", "", "night_sky_v2.png", "NIGHT SKY"},
+		{"nothing left keeps the name", "strip-prefix:bg_,strip-number", "", "bg_01.png", "bg_01"},
+		{"override wins", "strip-prefix:bg_,strip-number,spaces,title", `{"Background": {"bg_deep_space_01": "The Void"}}`, "bg_deep_space_01.png", "The Void"},
+		{"override of another layer", "strip-prefix:bg_,spaces,title", `{"Background": {"bg_sunset": "Dusk"}}`, "bg_deep_space.png", "Deep Space"},
+		{"override of another trait", "", `{"Hat": {"bg_deep_space_01": "The Void"}}`, "bg_deep_space_01.png", "bg_deep_space_01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DIR1_VALUES", tt.transform)
+			if tt.overrides != "" {
+				path := filepath.Join(t.TempDir(), "values.json")
+				writeFile(t, path, tt.overrides)
+				setFlag(t, "display-values", path)
+			}
+			t.Cleanup(func() {
+				clear(valueTransforms)
+				displayValues = nil
+			})
+
+			dir := newLayerDir("DIR1", filepath.Join(t.TempDir(), "1 Background"))
+			if err := loadDisplayValues([]LayerDir{dir}); err != nil {
+				t.Fatal(err)
+			}
+			layer := Layer{Name: tt.file, Trait: "Background", Path: filepath.Join(dir.Path, tt.file)}
+			if got := attributeValue(layer); got != tt.want {
+				t.Errorf("value of %s is %q, want %q", tt.file, got, tt.want)
+			}
+
+			// A left out layer is None whatever the transforms
+			if got := attributeValue(Layer{Name: noneTrait, Trait: "Background"}); got != noneTrait {
+				t.Errorf("absent layer value is %q", got)
+			}
+		})
+	}
+}
+
+func TestInvalidValueTransforms(t *testing.T) {
+	tests := []struct {
+		transform string
+		err       string
+	}{
+		{"strip-prefix", "Invalid DIR1_VALUES step 'strip-prefix', strip-prefix needs the text to strip"},
+		{"title:x", "Invalid DIR1_VALUES step 'title:x', title takes no argument"},
+		{"spaces,camel", "Invalid DIR1_VALUES step 'camel', expected strip-prefix:P"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.transform, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Background"), "bg_red.png")
+			out, err := runMixer(t, work, []string{"DIR1=1 Background", "DIR1_VALUES=" + tt.transform, "NFT_COUNT=1", "OUTPUT_DIR=out"})
+			if err == nil {
+				t.Fatalf("run succeeded:\n%s", out)
+			}
+			if !strings.Contains(out, tt.err) {
+				t.Errorf("output doesn't say %q:\n%s", tt.err, out)
+			}
+		})
+	}
+}
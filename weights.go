@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var temperature = flag.Float64("temperature", 1, "raise every rarity weight to this power: 1 keeps them, below 1 flattens toward uniform (0 is uniform), above 1 favors the heaviest")
+
+// splitWeight splits a layer file name of the form name#weight.png into
+// the name without extension and its rarity weight, 1 when it has none.
+func splitWeight(fileName string) (string, float64) {
+	name := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	if i := strings.LastIndex(name, "#"); i >= 0 {
+		weight, err := strconv.ParseFloat(name[i+1:], 64)
+		if err == nil && weight >= 0 {
+			return name[:i], weight
+		}
+	}
+	return name, 1
+}
+
+func getWeight(fileName string) float64 {
+	_, weight := splitWeight(fileName)
+	return weight
+}
+
+// applyTemperature returns weight^temperature. Zero weights stay zero so
+// disabled files are never picked, whatever the temperature.
+func applyTemperature(weight float64) float64 {
+	if weight <= 0 {
+		return 0
+	}
+	return math.Pow(weight, *temperature)
+}
+
+// pickWeighted returns an index drawn with probability proportional to its
+// weight, or -1 if all weights are zero.
+func pickWeighted(rng Randomizer, weights []float64) int {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	if total <= 0 {
+		return -1
+	}
+
+	r := rng.Float64() * total
+	for i, w := range weights {
+		if r < w {
+			return i
+		}
+		r -= w
+	}
+
+	// Rounding can leave r just past the end, use the last candidate
+	for i := len(weights) - 1; i >= 0; i-- {
+		if weights[i] > 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// pickWithoutReplacement draws k distinct indexes, each draw weighted among
+// the ones not picked yet. It returns nil if fewer than k have a weight.
+func pickWithoutReplacement(rng Randomizer, weights []float64, k int) []int {
+	remaining := append([]float64{}, weights...)
+	picked := make([]int, 0, k)
+
+	for len(picked) < k {
+		i := pickWeighted(rng, remaining)
+		if i < 0 {
+			return nil
+		}
+		picked = append(picked, i)
+		remaining[i] = 0
+	}
+	return picked
+}
+
+// getFileWeights returns the tempered weights of the files of a directory.
+func getFileWeights(names []string) []float64 {
+	weights := make([]float64, len(names))
+	for i, name := range names {
+		weights[i] = applyTemperature(getWeight(name))
+	}
+	return weights
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemperature(t *testing.T) {
+	names := []string{"common#8.png", "uncommon#4.png", "rare#2.png", "legendary#1.png", "disabled#0.png"}
+	tests := []struct {
+		name        string
+		temperature string
+		// want are the expected shares of the files, within tolerance
+		want      []float64
+		tolerance float64
+	}{
+		{"zero is uniform", "0", []float64{0.25, 0.25, 0.25, 0.25, 0}, 0.02},
+		{"one keeps the weights", "1", []float64{8.0 / 15, 4.0 / 15, 2.0 / 15, 1.0 / 15, 0}, 0.02},
+		{"half flattens", "0.5", []float64{0.3905, 0.2761, 0.1953, 0.1381, 0}, 0.02},
+		{"large concentrates on the heaviest", "10", []float64{1, 0, 0, 0, 0}, 0.002},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, "temperature", tt.temperature)
+			weights := getFileWeights(names)
+			rng := rand.New(rand.NewSource(1))
+
+			const draws = 20000
+			counts := make([]int, len(names))
+			for n := 0; n < draws; n++ {
+				counts[pickWeighted(rng, weights)]++
+			}
+			for f, want := range tt.want {
+				if got := float64(counts[f]) / draws; math.Abs(got-want) > tt.tolerance {
+					t.Errorf("%s drawn %.4f of the time, want %.4f", names[f], got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidTemperature(t *testing.T) {
+	for _, value := range []string{"-1", "-0.5", "-Inf", "+Inf", "NaN"} {
+		t.Run(value, func(t *testing.T) {
+			work := t.TempDir()
+			writeLayers(t, filepath.Join(work, "1 Hat"), "cap.png", "crown.png")
+			env := []string{"DIR1=1 Hat", "NFT_COUNT=1", "OUTPUT_DIR=out"}
+			out, err := runMixer(t, work, env, "-temperature", value)
+
+			if err == nil || !strings.Contains(out, "Invalid -temperature value") {
+				t.Fatalf("got %v:\n%s", err, out)
+			}
+			if _, err := os.Stat(filepath.Join(work, "out")); !os.IsNotExist(err) {
+				t.Error("the output directory was created")
+			}
+		})
+	}
+}